@@ -0,0 +1,221 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrDropped is returned by AsyncWriter when the data has been dropped because the queue is full.
+var ErrDropped = errors.New("dropped as the queue is full")
+
+// OverflowPolicy specifies what AsyncWriter does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// Waits until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+	// Drops the data being written.
+	OverflowDropNewest
+	// Drops the oldest data in the queue to make room.
+	OverflowDropOldest
+	// Waits until the queue has room for at most Timeout, and drops the data being written after that.
+	OverflowBlockWithTimeout
+)
+
+type asyncEntry struct {
+	b   []byte
+	ctx interface{}
+	seq int64
+}
+
+// AsyncWriter queues the data written to it, along with ctx, and writes them to Writer one by one in
+// a background goroutine, so that the writes don't wait for the storage.  What happens when the queue
+// is full is determined by Policy.  The data being dropped is counted by Dropped().  Errors returned by
+// Writer are reported to ErrorHandler with ErrorOnWrite.
+//
+// AsyncWriter must be created by NewAsyncWriter.
+type AsyncWriter struct {
+	Writer       ContextualWriter
+	Policy       OverflowPolicy
+	Timeout      time.Duration
+	ErrorHandler ErrorHandler
+	mtx          sync.Mutex
+	cond         *sync.Cond
+	queue        []asyncEntry
+	size         int
+	seq          int64
+	taken        int64
+	writingSeq   int64
+	dropped      int64
+	closed       bool
+	done         chan struct{}
+}
+
+// Creates a new AsyncWriter that queues up to size writes, and starts writing them to w.
+func NewAsyncWriter(w ContextualWriter, size int, policy OverflowPolicy) *AsyncWriter {
+	if size <= 0 {
+		size = 1
+	}
+	retval := &AsyncWriter{
+		Writer:       w,
+		Policy:       policy,
+		Timeout:      0,
+		ErrorHandler: nil,
+		mtx:          sync.Mutex{},
+		queue:        make([]asyncEntry, 0, size),
+		size:         size,
+		done:         make(chan struct{}),
+	}
+	retval.cond = sync.NewCond(&retval.mtx)
+	go retval.run()
+	return retval
+}
+
+// Write() method of io.Writer() interface.  This simply calls WriteWithCtx() with the second argument
+// being nil.
+func (w *AsyncWriter) Write(b []byte) (int, error) {
+	return w.WriteWithCtx(b, nil)
+}
+
+// WriteWithCtx() method of ContextualWriter interface.  b is copied into the queue.  ErrDropped is
+// returned if b has been dropped, and io.EOF is returned after Close() is called.
+func (w *AsyncWriter) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	var deadline time.Time
+	for !w.closed && len(w.queue) >= w.size {
+		switch w.Policy {
+		case OverflowDropNewest:
+			w.dropped += 1
+			return 0, ErrDropped
+		case OverflowDropOldest:
+			w.queue[0] = asyncEntry{}
+			w.queue = w.queue[1:]
+			w.taken += 1
+			w.dropped += 1
+		case OverflowBlockWithTimeout:
+			now := time.Now()
+			if deadline.IsZero() {
+				deadline = now.Add(w.Timeout)
+			}
+			if !now.Before(deadline) {
+				w.dropped += 1
+				return 0, ErrDropped
+			}
+			// sync.Cond cannot wait with a timeout by itself.
+			timer := time.AfterFunc(deadline.Sub(now), func() {
+				w.mtx.Lock()
+				w.cond.Broadcast()
+				w.mtx.Unlock()
+			})
+			w.cond.Wait()
+			timer.Stop()
+		default:
+			w.cond.Wait()
+		}
+	}
+	if w.closed {
+		return 0, io.EOF
+	}
+	w.seq += 1
+	w.queue = append(w.queue, asyncEntry{b: append([]byte(nil), b...), ctx: ctx, seq: w.seq})
+	w.cond.Broadcast()
+	return len(b), nil
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for {
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			return
+		}
+		e := w.queue[0]
+		w.queue[0] = asyncEntry{}
+		w.queue = w.queue[1:]
+		w.taken += 1
+		w.writingSeq = e.seq
+		w.cond.Broadcast()
+		w.mtx.Unlock()
+		_, err := w.Writer.WriteWithCtx(e.b, e.ctx)
+		if err != nil {
+			handleError(w.ErrorHandler, ErrorOnWrite, "", err)
+		}
+		w.mtx.Lock()
+		w.writingSeq = 0
+		w.cond.Broadcast()
+	}
+}
+
+// Returns the number of the writes that have been dropped so far.
+func (w *AsyncWriter) Dropped() int64 {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.dropped
+}
+
+// Returns the number of the writes in the queue.
+func (w *AsyncWriter) Queued() int {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return len(w.queue)
+}
+
+// Flush() method of Flusher interface.  This waits for the data that has been queued so far to be
+// written, and then flushes Writer if it implements Flusher.
+func (w *AsyncWriter) Flush() error {
+	w.mtx.Lock()
+	target := w.seq
+	// the entries are taken in order, so the ones up to target are done once as many have been taken
+	// and none of them is being written.
+	for w.taken < target && !w.closed || w.writingSeq != 0 && w.writingSeq <= target {
+		w.cond.Wait()
+	}
+	w.mtx.Unlock()
+	return flushWriter(w.Writer)
+}
+
+// Stops accepting writes, waits for the queued data to be written, and then closes Writer if it
+// implements io.Closer, or flushes it otherwise.
+func (w *AsyncWriter) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.cond.Broadcast()
+	w.mtx.Unlock()
+	<-w.done
+	c, ok := w.Writer.(io.Closer)
+	if ok {
+		return c.Close()
+	}
+	return flushWriter(w.Writer)
+}
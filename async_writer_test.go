@@ -0,0 +1,157 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type gatedWriter struct {
+	gate    chan struct{}
+	mtx     sync.Mutex
+	records []string
+	ctxs    []interface{}
+	flushes int
+}
+
+func (w *gatedWriter) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
+	<-w.gate
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.records = append(w.records, string(b))
+	w.ctxs = append(w.ctxs, ctx)
+	return len(b), nil
+}
+
+func (w *gatedWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.flushes += 1
+	return nil
+}
+
+// Writes "a" and waits for it to be taken by the background goroutine, which then gets stuck, and
+// fills the queue of size 2 with "b" and "c".
+func fillAsyncWriter(t *testing.T, policy OverflowPolicy) (*AsyncWriter, *gatedWriter) {
+	gw := &gatedWriter{gate: make(chan struct{})}
+	w := NewAsyncWriter(gw, 2, policy)
+	w.WriteWithCtx([]byte("a"), 1)
+	for w.Queued() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.WriteWithCtx([]byte("b"), 2)
+	w.WriteWithCtx([]byte("c"), 3)
+	return w, gw
+}
+
+func checkRecords(t *testing.T, gw *gatedWriter, expected ...string) {
+	gw.mtx.Lock()
+	defer gw.mtx.Unlock()
+	if len(gw.records) != len(expected) {
+		t.Logf("%q", gw.records)
+		t.FailNow()
+	}
+	for i, record := range gw.records {
+		if record != expected[i] {
+			t.Logf("%q", gw.records)
+			t.Fail()
+		}
+	}
+}
+
+func TestAsyncWriterDropNewest(t *testing.T) {
+	w, gw := fillAsyncWriter(t, OverflowDropNewest)
+	n, err := w.WriteWithCtx([]byte("d"), 4)
+	if n != 0 || err != ErrDropped || w.Dropped() != 1 {
+		t.Logf("%d %v %d", n, err, w.Dropped())
+		t.Fail()
+	}
+	close(gw.gate)
+	w.Close()
+	checkRecords(t, gw, "a", "b", "c")
+	if gw.ctxs[2] != 3 {
+		t.Logf("%v", gw.ctxs)
+		t.Fail()
+	}
+	if _, err := w.Write([]byte("e")); err == nil {
+		t.Fail()
+	}
+}
+
+func TestAsyncWriterDropOldest(t *testing.T) {
+	w, gw := fillAsyncWriter(t, OverflowDropOldest)
+	n, err := w.WriteWithCtx([]byte("d"), 4)
+	if n != 1 || err != nil || w.Dropped() != 1 {
+		t.Logf("%d %v %d", n, err, w.Dropped())
+		t.Fail()
+	}
+	close(gw.gate)
+	w.Close()
+	checkRecords(t, gw, "a", "c", "d")
+}
+
+func TestAsyncWriterBlockWithTimeout(t *testing.T) {
+	w, gw := fillAsyncWriter(t, OverflowBlockWithTimeout)
+	w.Timeout = 10 * time.Millisecond
+	start := time.Now()
+	_, err := w.Write([]byte("d"))
+	if err != ErrDropped || time.Since(start) < w.Timeout || w.Dropped() != 1 {
+		t.Logf("%v %v", err, time.Since(start))
+		t.Fail()
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(gw.gate)
+	}()
+	w.Timeout = time.Minute
+	_, err = w.Write([]byte("e"))
+	if err != nil {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	w.Close()
+	checkRecords(t, gw, "a", "b", "c", "e")
+}
+
+func TestAsyncWriterBlockAndFlush(t *testing.T) {
+	w, gw := fillAsyncWriter(t, OverflowBlock)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(gw.gate)
+	}()
+	w.Write([]byte("d"))
+	err := w.Flush()
+	if err != nil {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	checkRecords(t, gw, "a", "b", "c", "d")
+	if gw.flushes != 1 || w.Dropped() != 0 {
+		t.Logf("%d %d", gw.flushes, w.Dropped())
+		t.Fail()
+	}
+	w.Close()
+	if gw.flushes != 2 {
+		t.Fail()
+	}
+}
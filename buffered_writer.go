@@ -0,0 +1,148 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// bufferedWriter is a goroutine-safe bufio.Writer that also closes the underlying writer.
+type bufferedWriter struct {
+	mtx    sync.Mutex
+	w      io.Writer
+	bw     *bufio.Writer
+	closed bool
+}
+
+func newBufferedWriter(w io.Writer, size int) *bufferedWriter {
+	return &bufferedWriter{
+		mtx:    sync.Mutex{},
+		w:      w,
+		bw:     bufio.NewWriterSize(w, size),
+		closed: false,
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.closed {
+		return 0, io.EOF
+	}
+	return b.bw.Write(p)
+}
+
+func (b *bufferedWriter) Flush() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.closed {
+		return nil
+	}
+	return b.bw.Flush()
+}
+
+// Flushes the buffer and syncs the underlying writer if it has Sync() method.
+func (b *bufferedWriter) Sync() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.closed {
+		return nil
+	}
+	err := b.bw.Flush()
+	if err != nil {
+		return err
+	}
+	s, ok := b.w.(syncer)
+	if !ok {
+		return nil
+	}
+	return s.Sync()
+}
+
+// Flushes the buffer and closes the underlying writer if it is an io.Closer.  The first error that
+// occurs is returned.
+func (b *bufferedWriter) Close() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	err := b.bw.Flush()
+	c, ok := b.w.(io.Closer)
+	if ok {
+		err_ := c.Close()
+		if err == nil {
+			err = err_
+		}
+	}
+	return err
+}
+
+// Flushes wr if it is a Flusher.  Unsupported is not regarded as an error, as IOCombo returns it
+// when it has nothing to flush.
+func flushWriter(wr interface{}) error {
+	f, ok := wr.(Flusher)
+	if !ok {
+		return nil
+	}
+	err := f.Flush()
+	if err == Unsupported {
+		return nil
+	}
+	return err
+}
+
+// periodicTask calls the function every interval until it is stopped.
+type periodicTask struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startPeriodicTask(interval time.Duration, task func()) *periodicTask {
+	p := &periodicTask{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				task()
+			}
+		}
+	}()
+	return p
+}
+
+// Stops the task.  This must not be called from within the function given to it.
+func (p *periodicTask) Stop() {
+	close(p.stop)
+	<-p.done
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBufferedDynamicRotatingWriter(t *testing.T) {
+	count := 0
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return strconv.Itoa(count / 2)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		SerialRotationCallbackFactory(3),
+		nil,
+	)
+	w.BufferSize = 4096
+	w.Write([]byte("aaa\n"))
+	count++
+	b, _ := ioutil.ReadFile(headPath)
+	if len(b) != 0 {
+		t.Logf("not buffered: %q", b)
+		t.Fail()
+	}
+	w.Write([]byte("bbb\n"))
+	count++
+	// rotation must flush the buffer before the file is renamed.
+	w.Write([]byte("ccc\n"))
+	b, _ = ioutil.ReadFile(headPath + ".0")
+	if string(b) != "aaa\nbbb\n" {
+		t.Logf("%q", b)
+		t.Fail()
+	}
+	c := &IOCombo{Writer: w, Flusher: w, Closer: w}
+	c.Close()
+	b, _ = ioutil.ReadFile(headPath)
+	if string(b) != "ccc\n" {
+		t.Logf("%q", b)
+		t.Fail()
+	}
+}
+
+func TestBufferedStaticRotatingWriterFlushInterval(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	path := filepath.Join(baseDir, "TEST")
+	w := NewStaticRotatingWriter(
+		func(_ interface{}) (string, error) {
+			return path, nil
+		},
+		StandardWriterFactory,
+		nil,
+	)
+	w.BufferSize = 4096
+	w.FlushInterval = 10 * time.Millisecond
+	defer w.Close()
+	w.Write([]byte("aaa\n"))
+	for i := 0; i < 500; i++ {
+		b, _ := ioutil.ReadFile(path)
+		if string(b) == "aaa\n" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Logf("not flushed")
+	t.Fail()
+}
@@ -44,8 +44,10 @@ func (c *CloseHook) Close() error {
 func NewCloseHook(c io.Closer, callback func(s io.Closer)) *CloseHook {
 	reader, _ := c.(io.Reader)
 	contextualReader, _ := c.(ContextualReader)
+	readerContext, _ := c.(ReaderContext)
 	writer, _ := c.(io.Writer)
 	contextualWriter, _ := c.(ContextualWriter)
+	writerContext, _ := c.(WriterContext)
 	readerAt, _ := c.(io.ReaderAt)
 	writerAt, _ := c.(io.WriterAt)
 	seeker, _ := c.(io.Seeker)
@@ -57,9 +59,11 @@ func NewCloseHook(c io.Closer, callback func(s io.Closer)) *CloseHook {
 			Reader:           reader,
 			ReaderAt:         readerAt,
 			ContextualReader: contextualReader,
+			ReaderContext:    readerContext,
 			Writer:           writer,
 			WriterAt:         writerAt,
 			ContextualWriter: contextualWriter,
+			WriterContext:    writerContext,
 			Seeker:           seeker,
 			Closer:           c,
 			Flusher:          flusher,
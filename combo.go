@@ -21,6 +21,7 @@
 package ioextras
 
 import (
+	"context"
 	"errors"
 	"io"
 )
@@ -42,9 +43,11 @@ type IOCombo struct {
 	Reader           io.Reader
 	ReaderAt         io.ReaderAt
 	ContextualReader ContextualReader
+	ReaderContext    ReaderContext
 	Writer           io.Writer
 	WriterAt         io.WriterAt
 	ContextualWriter ContextualWriter
+	WriterContext    WriterContext
 	Seeker           io.Seeker
 	Closer           io.Closer
 	Flusher          Flusher
@@ -73,6 +76,13 @@ func (w *IOCombo) ReadWithCtx(b []byte, ctx interface{}) (int, error) {
 	return w.ContextualReader.ReadWithCtx(b, ctx)
 }
 
+func (w *IOCombo) ReadContext(ctx context.Context, b []byte) (int, error) {
+	if w.ReaderContext == nil {
+		return 0, Unsupported
+	}
+	return w.ReaderContext.ReadContext(ctx, b)
+}
+
 func (w *IOCombo) Write(b []byte) (int, error) {
 	if w.Writer == nil {
 		return 0, Unsupported
@@ -87,6 +97,13 @@ func (w *IOCombo) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
 	return w.ContextualWriter.WriteWithCtx(b, ctx)
 }
 
+func (w *IOCombo) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if w.WriterContext == nil {
+		return 0, Unsupported
+	}
+	return w.WriterContext.WriteContext(ctx, b)
+}
+
 func (w *IOCombo) WriteAt(b []byte, o int64) (int, error) {
 	if w.WriterAt == nil {
 		return 0, Unsupported
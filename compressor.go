@@ -0,0 +1,211 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Compression specifies the compression format used by Compressor.
+type Compression int
+
+const (
+	GzipCompression Compression = iota
+	ZlibCompression
+	FlateCompression
+)
+
+// Returns the suffix appended to the name of the compressed file.
+func (c Compression) Extension() string {
+	switch c {
+	case GzipCompression:
+		return ".gz"
+	case ZlibCompression:
+		return ".zz"
+	case FlateCompression:
+		return ".deflate"
+	}
+	panic("unknown compression")
+}
+
+func (c Compression) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case GzipCompression:
+		return gzip.NewReader(r)
+	case ZlibCompression:
+		return zlib.NewReader(r)
+	case FlateCompression:
+		return flate.NewReader(r), nil
+	}
+	panic("unknown compression")
+}
+
+// Returns the compression format the file is compressed with, judging by the extension.
+func compressionOf(path string) (Compression, bool) {
+	for _, c := range []Compression{GzipCompression, ZlibCompression, FlateCompression} {
+		if strings.HasSuffix(path, c.Extension()) {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+func (c Compression) newWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	switch c {
+	case GzipCompression:
+		return gzip.NewWriterLevel(w, level)
+	case ZlibCompression:
+		return zlib.NewWriterLevel(w, level)
+	case FlateCompression:
+		return flate.NewWriter(w, level)
+	}
+	panic("unknown compression")
+}
+
+// Compressor compresses the files rotated out by Renamer in background, so that the rotation itself
+// doesn't have to wait for it.  The compressed data is written to a hidden temporary file first and
+// then renamed to the path suffixed by the extension of the compression format, thus a half-written
+// archive never shows up.  The original file is removed after that.
+//
+// The next rotation of the same head path waits for the preceding compression to complete, so that
+// Renamer can safely shift the files as SerialRenamer does.
+type Compressor struct {
+	Renamer      Renamer
+	Compression  Compression
+	Level        int
+	ErrorHandler ErrorHandler
+	mtx          sync.Mutex
+	pending      map[string]chan struct{}
+	wg           sync.WaitGroup
+}
+
+// Creates a new Compressor.  errorHandler will receive errors that occur during compression with
+// ErrorOnCompression.  errorHandler can be nil.
+func NewCompressor(renamer Renamer, compression Compression, errorHandler ErrorHandler) *Compressor {
+	return &Compressor{
+		Renamer:      renamer,
+		Compression:  compression,
+		Level:        flate.DefaultCompression,
+		ErrorHandler: errorHandler,
+		mtx:          sync.Mutex{},
+		pending:      make(map[string]chan struct{}),
+	}
+}
+
+// Rename() has the same signature as Renamer.  This moves the file by Renamer and then schedules the
+// compression of the moved file.  The returned path is the one of the compressed file.
+func (c *Compressor) Rename(ID, path, src string, ctx interface{}) (string, error) {
+	c.mtx.Lock()
+	done, ok := c.pending[path]
+	c.mtx.Unlock()
+	if ok {
+		<-done
+	}
+	newPath, err := c.Renamer(ID, path, src, ctx)
+	if fatal, _ := splitDeferredErrors(err); fatal != nil {
+		return "", err
+	}
+	done = make(chan struct{})
+	c.mtx.Lock()
+	c.pending[path] = done
+	c.mtx.Unlock()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			c.mtx.Lock()
+			if c.pending[path] == done {
+				delete(c.pending, path)
+			}
+			c.mtx.Unlock()
+			close(done)
+		}()
+		err := c.compress(newPath)
+		if err != nil {
+			handleError(c.ErrorHandler, ErrorOnCompression, newPath, err)
+		}
+	}()
+	return newPath + c.Compression.Extension(), err
+}
+
+// RotationCallback() has the same signature as RotationCallback.  This does the same as Rename().
+func (c *Compressor) RotationCallback(ID, path string, ctx interface{}) error {
+	_, err := c.Rename(ID, path, path, ctx)
+	return err
+}
+
+// Waits for all the ongoing compressions to complete.
+func (c *Compressor) Wait() {
+	c.wg.Wait()
+}
+
+func (c *Compressor) compress(path string) error {
+	dest := path + c.Compression.Extension()
+	tmpPath := filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp")
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		defer tmp.Close()
+		cw, err := c.Compression.newWriter(tmp, c.Level)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(cw, src)
+		if err != nil {
+			return err
+		}
+		err = cw.Close()
+		if err != nil {
+			return err
+		}
+		return tmp.Close()
+	}()
+	if err == nil {
+		// keep the modification time so that the age of the file can still be told
+		err = os.Chtimes(tmpPath, fi.ModTime(), fi.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dest)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(path)
+}
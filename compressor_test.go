@@ -0,0 +1,98 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	count := 0
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	errs := &CollectingErrorHandler{}
+	c := NewCompressor(SerialRenamer(3), GzipCompression, errs)
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		c.RotationCallback,
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	w.Write([]byte("ddd\n"))
+	w.Write([]byte("eee\n"))
+	w.Close()
+	c.Wait()
+	for _, e := range errs.Reports() {
+		t.Logf("%s: %v", e.Path, e.Error)
+		t.Fail()
+	}
+	expected := map[string]string{
+		headPath + ".0.gz": "ddd\n",
+		headPath + ".1.gz": "ccc\n",
+		headPath + ".2.gz": "bbb\n",
+	}
+	for path, content := range expected {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Logf("%v", err)
+			t.Fail()
+			continue
+		}
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			t.Logf("%v", err)
+			t.Fail()
+			continue
+		}
+		b, err := ioutil.ReadAll(r)
+		f.Close()
+		if err != nil || string(b) != content {
+			t.Logf("%s: %q %v", path, b, err)
+			t.Fail()
+		}
+	}
+	names, _ := filepath.Glob(filepath.Join(baseDir, "*"))
+	if len(names) != 4 {
+		t.Logf("%v", names)
+		t.Fail()
+	}
+}
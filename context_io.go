@@ -0,0 +1,241 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// aLongTimeAgo is a deadline that has already passed, which aborts the ongoing I/O at once.
+var aLongTimeAgo = time.Unix(1, 0)
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+type ioResult struct {
+	data []byte
+	n    int
+	err  error
+}
+
+// Aborts the I/O by setting a deadline that has passed when ctx is done before the returned function
+// is called.  The deadline is reset by the function.
+func watchContext(ctx context.Context, setDeadline func(time.Time) error) func() {
+	deadline, _ := ctx.Deadline()
+	setDeadline(deadline)
+	if ctx.Done() == nil {
+		return func() {
+			setDeadline(time.Time{})
+		}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			setDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		setDeadline(time.Time{})
+	}
+}
+
+// Returns the error of ctx in place of err if the I/O has been aborted by ctx.  The timeout caused by
+// the deadline of ctx may be noticed before ctx itself is done.
+func contextError(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr != nil {
+		return ctxErr
+	}
+	deadline, ok := ctx.Deadline()
+	if ok && !time.Now().Before(deadline) {
+		t, ok := err.(interface {
+			Timeout() bool
+		})
+		if ok && t.Timeout() {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// readerContext brings an io.Reader up to ReaderContext.
+type readerContext struct {
+	r         io.Reader
+	deadliner readDeadliner
+	mtx       sync.Mutex
+	pending   chan ioResult
+	leftover  []byte
+	err       error
+}
+
+// Returns a ReaderContext that reads from r.  If r has SetReadDeadline() method that works, like
+// net.Conn and *os.File of a pipe, the blocked read is aborted by the deadline.  Otherwise the read is
+// done in another goroutine, and the data it reads after ReadContext() has returned by the
+// cancellation is returned by the next call.  r itself is returned if it is a ReaderContext already.
+func NewReaderContext(r io.Reader) ReaderContext {
+	rc, ok := r.(ReaderContext)
+	if ok {
+		return rc
+	}
+	d, ok := r.(readDeadliner)
+	if ok && d.SetReadDeadline(time.Time{}) != nil {
+		// e.g. *os.File of a regular file
+		d = nil
+	}
+	return &readerContext{r: r, deadliner: d}
+}
+
+func (r *readerContext) ReadContext(ctx context.Context, b []byte) (int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.pending == nil {
+		if len(r.leftover) > 0 {
+			n := copy(b, r.leftover)
+			r.leftover = r.leftover[n:]
+			if len(r.leftover) > 0 {
+				return n, nil
+			}
+			err := r.err
+			r.err = nil
+			return n, err
+		}
+		err := ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+		if r.deadliner != nil {
+			stop := watchContext(ctx, r.deadliner.SetReadDeadline)
+			n, err := r.r.Read(b)
+			stop()
+			if err != nil {
+				err = contextError(ctx, err)
+			}
+			return n, err
+		}
+		if ctx.Done() == nil {
+			return r.r.Read(b)
+		}
+		pending := make(chan ioResult, 1)
+		buf := make([]byte, len(b))
+		go func() {
+			n, err := r.r.Read(buf)
+			pending <- ioResult{buf[:n], n, err}
+		}()
+		r.pending = pending
+	}
+	select {
+	case result := <-r.pending:
+		r.pending = nil
+		n := copy(b, result.data)
+		if n < len(result.data) {
+			r.leftover, r.err = result.data[n:], result.err
+			return n, nil
+		}
+		return n, result.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// writerContext brings an io.Writer up to WriterContext.
+type writerContext struct {
+	w         io.Writer
+	deadliner writeDeadliner
+	mtx       sync.Mutex
+	pending   chan ioResult
+}
+
+// Returns a WriterContext that writes to w.  If w has SetWriteDeadline() method that works, the
+// blocked write is aborted by the deadline.  Otherwise the write is done in another goroutine, which
+// goes on after WriteContext() has returned by the cancellation; the next call waits for it to
+// complete first, and returns its error if it has failed.  w itself is returned if it is a
+// WriterContext already.
+func NewWriterContext(w io.Writer) WriterContext {
+	wc, ok := w.(WriterContext)
+	if ok {
+		return wc
+	}
+	d, ok := w.(writeDeadliner)
+	if ok && d.SetWriteDeadline(time.Time{}) != nil {
+		d = nil
+	}
+	return &writerContext{w: w, deadliner: d}
+}
+
+func (w *writerContext) WriteContext(ctx context.Context, b []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.pending != nil {
+		// the writes must not be reordered.
+		select {
+		case result := <-w.pending:
+			w.pending = nil
+			if result.err != nil {
+				return 0, result.err
+			}
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	err := ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	if w.deadliner != nil {
+		stop := watchContext(ctx, w.deadliner.SetWriteDeadline)
+		n, err := w.w.Write(b)
+		stop()
+		if err != nil {
+			err = contextError(ctx, err)
+		}
+		return n, err
+	}
+	if ctx.Done() == nil {
+		return w.w.Write(b)
+	}
+	pending := make(chan ioResult, 1)
+	buf := append([]byte(nil), b...)
+	go func() {
+		n, err := w.w.Write(buf)
+		pending <- ioResult{nil, n, err}
+	}()
+	select {
+	case result := <-pending:
+		return result.n, result.err
+	case <-ctx.Done():
+		w.pending = pending
+		return 0, ctx.Err()
+	}
+}
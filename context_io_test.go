@@ -0,0 +1,142 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func cancelLater(d time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(d, cancel)
+	return ctx
+}
+
+func TestReaderContextDeadline(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	defer w.Close()
+	rc := NewReaderContext(r)
+	b := make([]byte, 16)
+	_, err = rc.ReadContext(cancelLater(10*time.Millisecond), b)
+	if err != context.Canceled {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = rc.ReadContext(ctx, b)
+	if err != context.DeadlineExceeded {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	w.Write([]byte("aaa"))
+	n, err := rc.ReadContext(context.Background(), b)
+	if err != nil || string(b[:n]) != "aaa" {
+		t.Logf("%q %v", b[:n], err)
+		t.Fail()
+	}
+}
+
+func TestReaderContextGoroutine(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rc := NewReaderContext(r)
+	b := make([]byte, 2)
+	_, err := rc.ReadContext(cancelLater(10*time.Millisecond), b)
+	if err != context.Canceled {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	go w.Write([]byte("aaa"))
+	// the data read after the cancellation must not be lost.
+	s := ""
+	for len(s) < 3 {
+		n, err := rc.ReadContext(context.Background(), b)
+		if err != nil {
+			t.Logf("%v", err)
+			t.FailNow()
+		}
+		s += string(b[:n])
+	}
+	if s != "aaa" {
+		t.Logf("%q", s)
+		t.Fail()
+	}
+}
+
+func TestWriterContextGoroutine(t *testing.T) {
+	r, w := io.Pipe()
+	wc := NewWriterContext(w)
+	_, err := wc.WriteContext(cancelLater(10*time.Millisecond), []byte("aaa"))
+	if err != context.Canceled {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	result := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		result <- string(b)
+	}()
+	n, err := wc.WriteContext(context.Background(), []byte("bbb"))
+	if n != 3 || err != nil {
+		t.Logf("%d %v", n, err)
+		t.Fail()
+	}
+	w.Close()
+	if s := <-result; s != "aaabbb" {
+		t.Logf("%q", s)
+		t.Fail()
+	}
+}
+
+func TestIOComboContext(t *testing.T) {
+	r, w := io.Pipe()
+	c := &IOCombo{ReaderContext: NewReaderContext(r), WriterContext: NewWriterContext(w)}
+	go c.WriteContext(context.Background(), []byte("aaa"))
+	b := make([]byte, 3)
+	n, err := c.ReadContext(context.Background(), b)
+	if err != nil || string(b[:n]) != "aaa" {
+		t.Logf("%q %v", b[:n], err)
+		t.Fail()
+	}
+	// CloseHook carries WriterContext through.
+	h := NewCloseHook(struct {
+		io.Closer
+		WriterContext
+	}{w, NewWriterContext(w)}, func(io.Closer) {})
+	go h.WriteContext(context.Background(), []byte("bbb"))
+	n, err = c.ReadContext(context.Background(), b)
+	if err != nil || string(b[:n]) != "bbb" {
+		t.Logf("%q %v", b[:n], err)
+		t.Fail()
+	}
+	h.Close()
+}
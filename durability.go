@@ -0,0 +1,178 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DurabilityMode specifies when the data written to the files are committed to the storage.
+type DurabilityMode int
+
+const (
+	// Leaves it up to the operating system.
+	DurabilityNone DurabilityMode = iota
+	// Syncs the file before it is closed, that is, before RotationCallback is called.
+	DurabilitySyncOnRotate
+	// Syncs the file every SyncEveryBytes bytes and / or every SyncInterval, in addition to what
+	// DurabilitySyncOnRotate does.
+	DurabilitySyncPeriodic
+	// Opens the file with O_DSYNC so that every write is synchronous.
+	DurabilityDSync
+)
+
+// DurabilityPolicy is given to the rotating writers to control the durability of the files.  With any
+// mode other than DurabilityNone, the directory containing the head file is also synced after
+// RotationCallback is called, so that the renames done by the callback are committed as well.  That
+// is a single sync after all the renames, which doesn't commit them in order; the callbacks returned
+// by SerialRotationCallbackFactory and SerialRenamer never sync the directory by themselves, thus
+// DurableSerialRotationCallbackFactory, DurableSerialRenamer or JournaledSerialRenamer is required
+// for the shifted files to survive a crash in the middle of the rotation.
+//
+// For DurabilityDSync, the files that are returned by WriterFactory as *os.File are opened once
+// again with O_DSYNC (and O_APPEND) added.  The other writers are synced after every write if they
+// have Sync() method, except for the ones opened by FileWriterFactory with DSync set to true.
+type DurabilityPolicy struct {
+	Mode           DurabilityMode
+	SyncEveryBytes int64
+	SyncInterval   time.Duration
+}
+
+type syncer interface {
+	Sync() error
+}
+
+// durableWriter syncs the underlying writer according to the policy.
+type durableWriter struct {
+	mtx      sync.Mutex
+	w        io.Writer
+	policy   DurabilityPolicy
+	unsynced int64
+}
+
+func (d *durableWriter) Write(p []byte) (int, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	n, err := d.w.Write(p)
+	d.unsynced += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if d.policy.Mode == DurabilityDSync || (d.policy.Mode == DurabilitySyncPeriodic && d.policy.SyncEveryBytes > 0 && d.unsynced >= d.policy.SyncEveryBytes) {
+		err = d.sync()
+	}
+	return n, err
+}
+
+func (d *durableWriter) sync() error {
+	d.unsynced = 0
+	s, ok := d.w.(syncer)
+	if !ok {
+		return nil
+	}
+	return s.Sync()
+}
+
+func (d *durableWriter) Sync() error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.sync()
+}
+
+// Syncs the underlying writer unless nothing has been written since the last sync, and then closes it.
+func (d *durableWriter) Close() error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	var err error
+	if d.unsynced > 0 {
+		err = d.sync()
+	}
+	c, ok := d.w.(io.Closer)
+	if ok {
+		err_ := c.Close()
+		if err == nil {
+			err = err_
+		}
+	}
+	return err
+}
+
+// Wraps the writer returned by WriterFactory so that it is synced according to the policy.
+func (p DurabilityPolicy) wrap(wr io.Writer) (io.Writer, error) {
+	switch p.Mode {
+	case DurabilityNone:
+		return wr, nil
+	case DurabilityDSync:
+		lf, ok := wr.(*lockedFile)
+		if ok && lf.dsync {
+			return lf, nil
+		}
+		// reopening a locked file would release the lock, so it is synced after every write instead.
+		f, ok := wr.(*os.File)
+		if ok {
+			f_, err := os.OpenFile(f.Name(), os.O_WRONLY|os.O_APPEND|oDSync, 0)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			// no need to wrap any further, as the writes are synchronous by themselves.
+			return f_, nil
+		}
+	}
+	return &durableWriter{
+		mtx:      sync.Mutex{},
+		w:        wr,
+		policy:   p,
+		unsynced: 0,
+	}, nil
+}
+
+// Flushes the writer if it is a Flusher, and then syncs it if it has Sync() method.
+func syncWriter(wr io.Writer) error {
+	err := flushWriter(wr)
+	if err != nil {
+		return err
+	}
+	s, ok := wr.(syncer)
+	if !ok {
+		return nil
+	}
+	return s.Sync()
+}
+
+// Commits the entries of the directory containing path to the storage.  This is a no-op on Windows,
+// where directories cannot be synced.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type syncCountingWriter struct {
+	bytes.Buffer
+	syncs *[]int
+}
+
+func (w *syncCountingWriter) Sync() error {
+	*w.syncs = append(*w.syncs, w.Len())
+	return nil
+}
+
+func TestDurabilitySyncPeriodic(t *testing.T) {
+	count := 0
+	syncs := []int{}
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return strconv.Itoa(count / 3)
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			return &syncCountingWriter{syncs: &syncs}, nil
+		},
+		func(id string, _ interface{}) string {
+			return id
+		},
+		nil,
+		nil,
+	)
+	w.Durability = DurabilityPolicy{Mode: DurabilitySyncPeriodic, SyncEveryBytes: 8}
+	for ; count < 4; count++ {
+		w.Write([]byte("aaaa"))
+	}
+	w.Close()
+	// synced after 8 bytes, before rotation with 12 bytes, and on close with 4 bytes.
+	if len(syncs) != 3 || syncs[0] != 8 || syncs[1] != 12 || syncs[2] != 4 {
+		t.Logf("%v", syncs)
+		t.Fail()
+	}
+}
+
+func TestDurabilityDSync(t *testing.T) {
+	count := 0
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count / 2)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		DurableSerialRotationCallbackFactory(3),
+		nil,
+	)
+	w.Durability = DurabilityPolicy{Mode: DurabilityDSync}
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	w.Close()
+	b, err := ioutil.ReadFile(headPath + ".0")
+	if err != nil || string(b) != "aaa\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+	b, err = ioutil.ReadFile(headPath)
+	if err != nil || string(b) != "bbb\nccc\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
@@ -24,13 +24,20 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // IDBuilder is supposed to return a string that determines the rotation cycle.
 // Rotation occurs when it returns an identifier different from the one obtained during
 // the previous call to WriteWithCtx() method.
 // ctx argument is the value passed to WriteWithCtx() method as the second argument.
+// When the file has just been opened and already has some content, it is called once more
+// within the same call to WriteWithCtx() so that the content is taken into account; the file
+// gets rotated again if the identifier differs from the one it has been opened with.
 type IDBuilder func(w io.Writer, ctx interface{}) string
 
 // HeadPathGenerator is supposed to return the path to the file data is written to.
@@ -38,6 +45,12 @@ type IDBuilder func(w io.Writer, ctx interface{}) string
 // ctx argument is the value passed to WriteWithCtx() method as the second argument.
 type HeadPathGenerator func(ID string, ctx interface{}) string
 
+// FileHook is called with the writer to write to the file directly, the path to the file and the ID of
+// the rotation cycle the file belongs to, which is always empty for StaticRotatingWriter.  It can be
+// used to write a header or a footer.  ctx is the value passed to WriteWithCtx() method, or nil if the
+// hook is not called from there.
+type FileHook func(w io.Writer, path, ID string, ctx interface{}) error
+
 // RotationCallback is called when rotation occurs.  Typically the callback would rename the
 // file specified by path to something like xxx.1 so that the generated files are rotating.
 type RotationCallback func(ID, path string, ctx interface{}) error
@@ -47,16 +60,56 @@ type RotationCallback func(ID, path string, ctx interface{}) error
 // value of IDBuilder.  The file is created by WriterFactory.  RotationCallback will be called
 // on rotation.
 type DynamicRotatingWriter struct {
-	IDBuilder            IDBuilder
-	WriterFactory        WriterFactory
-	HeadPathGenerator    HeadPathGenerator
-	RotationCallback     RotationCallback
+	IDBuilder         IDBuilder
+	WriterFactory     WriterFactory
+	HeadPathGenerator HeadPathGenerator
+	RotationCallback  RotationCallback
+	// Passes the rotated files to the Renamer of RotationQueue in background instead of calling
+	// RotationCallback if set.  Close() waits for the queued files to be done.
+	RotationQueue *RotationQueue
+	// Receives the errors that occur during closing files.  CloseErrorReportChan is only used
+	// when ErrorHandler is nil, and is kept for compatibility.  The errors that the channel is not
+	// ready to receive are logged and dropped, thus it should be buffered.
+	ErrorHandler         ErrorHandler
 	CloseErrorReportChan chan<- CloserErrorPair
-	mtx                  sync.Mutex
-	currentID            string
-	currentWriter        io.Writer
-	currentPath          string
-	closed               bool
+	// Checks if the head file is still there every WatchEveryNWrites writes and / or WatchInterval
+	// when either of them is non-zero.  If it has been removed or replaced by another file, it is
+	// reopened and HeadFileChangedCallback is called with its path.
+	WatchEveryNWrites       int
+	WatchInterval           time.Duration
+	HeadFileChangedCallback func(path string)
+	// Buffers the data written to the file by BufferSize bytes when it is positive.  The buffer is
+	// flushed when it gets full, every FlushInterval if that is positive too, before the file is
+	// closed for rotation, and on Flush() and Close().
+	BufferSize    int
+	FlushInterval time.Duration
+	// Controls when the data is committed to the storage.  See DurabilityPolicy.
+	Durability DurabilityPolicy
+	// Called right after a file is opened and right before it is closed respectively, so that a
+	// header and a footer can be written.  OnOpen is not called for a file that already has some
+	// content.  An error from OnOpen is returned from WriteWithCtx().
+	OnOpen  FileHook
+	OnClose FileHook
+	// Keeps the symbolic link at SymlinkPath pointing to the file most recently opened if it is
+	// non-empty.  The link is replaced atomically.
+	SymlinkPath      string
+	mtx              sync.Mutex
+	currentID        string
+	currentWriter    io.Writer
+	currentPath      string
+	currentSize      int64
+	openedSize       int64
+	currentFileInfo  os.FileInfo
+	pendingSize      int64
+	writesSinceCheck int
+	lastCheck        time.Time
+	pendingErrors    []pendingErrorReport
+	reporting        sync.WaitGroup
+	flusher          *periodicTask
+	syncTask         *periodicTask
+	stats            statsRecorder
+	closed           bool
+	done             chan struct{}
 }
 
 // Write() method of io.Writer() interface.  This simply calls WriteWithCtx() with the second argument
@@ -66,86 +119,373 @@ func (w *DynamicRotatingWriter) Write(b []byte) (int, error) {
 }
 
 // WriteWithCtx() method of ContextualWriter interface.  This function is designed to be reentrant,
-// Because of the dynamic nature of 
+// Because of the dynamic nature of
 func (w *DynamicRotatingWriter) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
+	changedPath := ""
+	defer func() {
+		// called outside the lock so that the callback can do anything with the writer.
+		if changedPath != "" && w.HeadFileChangedCallback != nil {
+			w.HeadFileChangedCallback(changedPath)
+		}
+	}()
 	w.mtx.Lock()
-	defer w.mtx.Unlock()
+	defer w.unlock()
 	if w.closed {
 		return 0, io.EOF
 	}
+	w.pendingSize = int64(len(b))
 	id := w.IDBuilder(w, ctx)
-	if id != w.currentID || w.currentWriter == nil {
-		if w.currentWriter != nil {
-			c, ok := (w.currentWriter).(io.Closer)
-			if ok {
-				err := c.Close()
+	if w.currentPath != "" && (id != w.currentID || w.currentWriter == nil) {
+		err := w.rotate(ctx, true)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.currentWriter == nil {
+		err := w.open(id, ctx)
+		if err != nil {
+			return 0, err
+		}
+		// the file may have been there with some content; give IDBuilder
+		// a chance to look at it before writing anything.  The content written by
+		// OnOpen doesn't count.
+		if w.openedSize > 0 {
+			id = w.IDBuilder(w, ctx)
+			if id != w.currentID {
+				// nothing has been written to the file, thus it doesn't count.
+				err := w.rotate(ctx, false)
 				if err != nil {
-					w.CloseErrorReportChan <- CloserErrorPair{c, err}
+					return 0, err
 				}
-			}
-			w.currentWriter = nil
-		}
-		if w.currentPath != "" {
-			if w.RotationCallback != nil {
-				err := w.RotationCallback(w.currentID, w.currentPath, ctx)
+				err = w.open(id, ctx)
 				if err != nil {
 					return 0, err
 				}
 			}
-			w.currentPath = ""
 		}
-		path := w.HeadPathGenerator(id, ctx)
-		wr, err := w.WriterFactory(path, ctx)
+	} else if w.watchDue() && w.headFileChanged() {
+		changedPath = w.currentPath
+		err := w.reopen(ctx)
 		if err != nil {
 			return 0, err
 		}
-		w.currentWriter = wr
-		w.currentPath = path
-		w.currentID = id
 	}
-	return w.currentWriter.Write(b)
+	n, err := w.currentWriter.Write(b)
+	w.currentSize += int64(n)
+	w.stats.recordWrite(w.currentPath, n)
+	return n, err
 }
 
-func (w *DynamicRotatingWriter) Close() error {
-	w.mtx.Lock()
-	defer w.mtx.Unlock()
-	if w.closed {
-		return nil
+// Releases the lock and then reports the errors that have occurred while it was held.
+func (w *DynamicRotatingWriter) unlock() {
+	reports := w.pendingErrors
+	w.pendingErrors = nil
+	if len(reports) == 0 {
+		w.mtx.Unlock()
+		return
 	}
+	w.reporting.Add(1)
+	w.mtx.Unlock()
+	defer w.reporting.Done()
+	reportErrors(w.ErrorHandler, w.CloseErrorReportChan, reports)
+}
+
+func (w *DynamicRotatingWriter) closeCurrent(ctx interface{}) {
 	if w.currentWriter != nil {
+		if w.OnClose != nil {
+			err := w.OnClose(headWriter{w}, w.currentPath, w.currentID, ctx)
+			if err != nil {
+				w.pendingErrors = append(w.pendingErrors, pendingErrorReport{ErrorOnHook, w.currentPath, nil, err, nil})
+			}
+		}
 		c, ok := (w.currentWriter).(io.Closer)
 		if ok {
 			err := c.Close()
 			if err != nil {
-				w.CloseErrorReportChan <- CloserErrorPair{c, err}
+				w.pendingErrors = append(w.pendingErrors, pendingErrorReport{ErrorOnClose, w.currentPath, c, err, nil})
+				w.stats.recordCloseError()
 			}
 		}
+		w.stats.forgetPath(w.currentPath)
 		w.currentWriter = nil
 	}
+}
+
+// Closes the current file and calls RotationCallback.  The rotation is counted in the statistics if
+// counted is true and it succeeds.
+func (w *DynamicRotatingWriter) rotate(ctx interface{}, counted bool) error {
+	w.closeCurrent(ctx)
+	if w.currentPath != "" {
+		rotationCallback := w.RotationCallback
+		if w.RotationQueue != nil {
+			rotationCallback = w.RotationQueue.RotationCallback
+		}
+		if rotationCallback != nil {
+			start := time.Now()
+			err := rotationCallback(w.currentID, w.currentPath, ctx)
+			elapsed := time.Since(start)
+			// the errors deferred by the callback are reported after unlock().
+			err, reports := splitDeferredErrors(err)
+			w.pendingErrors = append(w.pendingErrors, reports...)
+			if err != nil {
+				return err
+			}
+			if counted {
+				w.stats.recordRotation(elapsed)
+			}
+			if w.Durability.Mode != DurabilityNone {
+				err = syncDir(w.currentPath)
+				if err != nil {
+					w.pendingErrors = append(w.pendingErrors, pendingErrorReport{ErrorOnSync, w.currentPath, nil, err, nil})
+				}
+			}
+		} else if counted {
+			w.stats.recordRotation(0)
+		}
+		w.currentPath = ""
+	}
+	return nil
+}
+
+func (w *DynamicRotatingWriter) open(id string, ctx interface{}) error {
+	return w.openPath(w.HeadPathGenerator(id, ctx), id, ctx)
+}
+
+func (w *DynamicRotatingWriter) reopen(ctx interface{}) error {
+	w.closeCurrent(ctx)
+	err := w.openPath(w.currentPath, w.currentID, ctx)
+	if err != nil && w.currentWriter == nil {
+		// there is nothing to rotate any longer.
+		w.currentPath = ""
+	}
+	return err
+}
+
+func (w *DynamicRotatingWriter) openPath(path, id string, ctx interface{}) error {
+	wr, err := w.WriterFactory(path, ctx)
+	if err != nil {
+		return err
+	}
+	w.setFileInfo(wr)
+	// remembered before OnOpen writes anything.
+	w.openedSize = w.currentSize
+	wr, err = w.wrap(wr)
+	if err != nil {
+		return err
+	}
+	w.currentWriter = wr
+	w.currentPath = path
+	w.currentID = id
+	if w.SymlinkPath != "" {
+		err := updateSymlink(w.SymlinkPath, path)
+		if err != nil {
+			w.pendingErrors = append(w.pendingErrors, pendingErrorReport{ErrorOnSymlink, w.SymlinkPath, nil, err, nil})
+		}
+	}
+	if w.currentSize == 0 && w.OnOpen != nil {
+		return w.OnOpen(headWriter{w}, path, id, ctx)
+	}
+	return nil
+}
+
+// headWriter is given to the hooks to write to the current file directly.
+type headWriter struct {
+	w *DynamicRotatingWriter
+}
+
+func (h headWriter) Write(b []byte) (int, error) {
+	n, err := h.w.currentWriter.Write(b)
+	h.w.currentSize += int64(n)
+	h.w.stats.recordWrite(h.w.currentPath, n)
+	return n, err
+}
+
+// Wraps the writer returned by WriterFactory according to Durability and BufferSize.
+func (w *DynamicRotatingWriter) wrap(wr io.Writer) (io.Writer, error) {
+	wr, err := w.Durability.wrap(wr)
+	if err != nil {
+		return nil, err
+	}
+	if w.Durability.Mode == DurabilitySyncPeriodic && w.Durability.SyncInterval > 0 && w.syncTask == nil {
+		w.syncTask = startPeriodicTask(w.Durability.SyncInterval, func() {
+			err := w.Sync()
+			if err != nil {
+				handleError(w.ErrorHandler, ErrorOnSync, "", err)
+			}
+		})
+	}
+	if w.BufferSize <= 0 {
+		return wr, nil
+	}
+	if w.FlushInterval > 0 && w.flusher == nil {
+		w.flusher = startPeriodicTask(w.FlushInterval, func() {
+			err := w.Flush()
+			if err != nil {
+				handleError(w.ErrorHandler, ErrorOnFlush, "", err)
+			}
+		})
+	}
+	return newBufferedWriter(wr, w.BufferSize), nil
+}
+
+// Flush() method of Flusher interface.  Flushes the buffered data, if any, to the current file.
+func (w *DynamicRotatingWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.unlock()
+	return flushWriter(w.currentWriter)
+}
+
+// Flushes the buffered data, if any, and commits the current file to the storage.
+func (w *DynamicRotatingWriter) Sync() error {
+	w.mtx.Lock()
+	defer w.unlock()
+	return syncWriter(w.currentWriter)
+}
+
+func (w *DynamicRotatingWriter) setFileInfo(wr io.Writer) {
+	w.currentFileInfo = writerFileInfo(wr)
+	if w.currentFileInfo != nil {
+		w.currentSize = w.currentFileInfo.Size()
+	} else {
+		w.currentSize = writerSize(wr)
+	}
+	w.writesSinceCheck = 0
+	w.lastCheck = time.Now()
+}
+
+func (w *DynamicRotatingWriter) watchDue() bool {
+	if w.WatchEveryNWrites <= 0 && w.WatchInterval <= 0 {
+		return false
+	}
+	w.writesSinceCheck++
+	if w.WatchEveryNWrites > 0 && w.writesSinceCheck >= w.WatchEveryNWrites {
+		return true
+	}
+	return w.WatchInterval > 0 && time.Since(w.lastCheck) >= w.WatchInterval
+}
+
+// Tells if the file at the head path is no longer the one being written.
+func (w *DynamicRotatingWriter) headFileChanged() bool {
+	w.writesSinceCheck = 0
+	w.lastCheck = time.Now()
+	if w.currentFileInfo == nil {
+		return false
+	}
+	fi, err := os.Stat(w.currentPath)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return !os.SameFile(w.currentFileInfo, fi)
+}
+
+// Forces rotation regardless of the ID.  The current file is closed and RotationCallback is called
+// in the same way as the ID changes, then the next write goes to a newly opened file.  ctx is passed
+// to RotationCallback as it is.  Nothing happens if no file is open.
+func (w *DynamicRotatingWriter) Rotate(ctx interface{}) error {
+	w.mtx.Lock()
+	defer w.unlock()
+	if w.closed {
+		return io.EOF
+	}
+	return w.rotate(ctx, true)
+}
+
+// Closes the current file and opens the same path again, without calling RotationCallback.  This is
+// useful when the file has been moved by someone else, like logrotate.  nil is passed to WriterFactory
+// as ctx.  Nothing happens if no file is open.
+func (w *DynamicRotatingWriter) Reopen() error {
+	w.mtx.Lock()
+	defer w.unlock()
+	if w.closed {
+		return io.EOF
+	}
+	if w.currentWriter == nil {
+		return nil
+	}
+	return w.reopen(nil)
+}
+
+// sizeTracker is a writer that keeps track of the number of bytes the current file holds, including
+// those that were already there when the file got opened, and of the number of bytes that are going to
+// be written by the ongoing call to WriteWithCtx().  They are only valid within IDBuilder, which is
+// called with the lock held.
+type sizeTracker interface {
+	trackedSizes() (current int64, pending int64)
+}
+
+func (w *DynamicRotatingWriter) trackedSizes() (int64, int64) {
+	return w.currentSize, w.pendingSize
+}
+
+func (w *DynamicRotatingWriter) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return nil
+	}
+	w.closeCurrent(nil)
 	w.closed = true
-	close(w.CloseErrorReportChan)
+	if w.done != nil {
+		close(w.done)
+	}
+	tasks := []*periodicTask{w.flusher, w.syncTask}
+	w.flusher, w.syncTask = nil, nil
+	w.unlock()
+	for _, task := range tasks {
+		if task != nil {
+			task.Stop()
+		}
+	}
+	if w.RotationQueue != nil {
+		w.RotationQueue.Wait()
+	}
+	if w.CloseErrorReportChan != nil {
+		w.reporting.Wait()
+		close(w.CloseErrorReportChan)
+	}
 	return nil
 }
 
+// Done() method of DoneNotifier interface.  The returned channel is closed when Close() is called.
+func (w *DynamicRotatingWriter) Done() <-chan struct{} {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.done == nil {
+		w.done = make(chan struct{})
+		if w.closed {
+			close(w.done)
+		}
+	}
+	return w.done
+}
+
+// Stats() method of StatsProvider interface.
+func (w *DynamicRotatingWriter) Stats() WriterStats {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	stats := WriterStats{
+		CurrentID:   w.currentID,
+		CurrentPath: w.currentPath,
+	}
+	if w.currentWriter != nil {
+		stats.OpenFiles = 1
+	}
+	w.stats.snapshot(&stats)
+	return stats
+}
+
 // Creates a new DynamicRotatingWriter. Pass StandardWriterFactory as writerFactory if you aren't
 // interested in any contextual information passed as the second argument of WriteWithCtx() when
-// opening the file.  closeErrorReportChan is a channel that will asynchronously receive errors
-// that occur during closing files that have been opened bby writerFastory.  closeErrorReportChan
-// can be nil.
+// opening the file.  closeErrorReportChan is a channel that will receive errors that occur during
+// closing files that have been opened bby writerFastory, and is closed on Close().
+// closeErrorReportChan can be nil, in which case the errors are dropped unless ErrorHandler is set.
 func NewDynamicRotatingWriter(idBuilder IDBuilder, writerFactory WriterFactory, headPathGenerator HeadPathGenerator, rotationCallback RotationCallback, closeErrorReportChan chan<- CloserErrorPair) *DynamicRotatingWriter {
-	if closeErrorReportChan == nil {
-		closeErrorReportChan_ := make(chan CloserErrorPair)
-		closeErrorReportChan = (chan<- CloserErrorPair)(closeErrorReportChan_)
-		go func() {
-			for _ = range closeErrorReportChan_ {
-			} // just ignoring errors
-		}()
-	}
 	return &DynamicRotatingWriter{
 		IDBuilder:            idBuilder,
 		WriterFactory:        writerFactory,
 		HeadPathGenerator:    headPathGenerator,
 		RotationCallback:     rotationCallback,
+		ErrorHandler:         nil,
 		CloseErrorReportChan: closeErrorReportChan,
 		currentID:            "",
 		currentWriter:        nil,
@@ -153,42 +493,287 @@ func NewDynamicRotatingWriter(idBuilder IDBuilder, writerFactory WriterFactory,
 	}
 }
 
+// Creates a new DynamicRotatingWriter that rotates the file once it would grow past maxSize bytes.
+// See SizeBasedIDBuilderFactory for detail.
+func NewSizeBasedRotatingWriter(maxSize int64, writerFactory WriterFactory, headPathGenerator HeadPathGenerator, rotationCallback RotationCallback, closeErrorReportChan chan<- CloserErrorPair) *DynamicRotatingWriter {
+	return NewDynamicRotatingWriter(SizeBasedIDBuilderFactory(maxSize), writerFactory, headPathGenerator, rotationCallback, closeErrorReportChan)
+}
+
+func writerFileInfo(wr io.Writer) os.FileInfo {
+	f, ok := wr.(interface {
+		Stat() (os.FileInfo, error)
+	})
+	if !ok {
+		return nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	return fi
+}
+
+// Returns the size of the file the writer writes to, as far as it can be told.
+func writerFileSize(wr io.Writer) int64 {
+	fi := writerFileInfo(wr)
+	if fi != nil {
+		return fi.Size()
+	}
+	return writerSize(wr)
+}
+
+func writerSize(wr io.Writer) int64 {
+	sized, ok := wr.(Sized)
+	if ok {
+		size, err := sized.Size()
+		if err == nil {
+			return size
+		}
+	}
+	return 0
+}
+
+// This is a factory function that returns an IDBuilder which yields a new ID every time the current
+// file would grow past maxSize bytes by the pending write.  It can only be used with
+// DynamicRotatingWriter, which keeps track of the size so that it is never examined by stat'ing the
+// file on each write.  A single write that is larger than maxSize goes to an empty file as a whole.
+func SizeBasedIDBuilderFactory(maxSize int64) IDBuilder {
+	generation := int64(0)
+	return func(w io.Writer, _ interface{}) string {
+		st, ok := w.(sizeTracker)
+		if !ok {
+			panic("the size-based IDBuilder is used with a writer other than DynamicRotatingWriter")
+		}
+		current, pending := st.trackedSizes()
+		if current > 0 && current+pending > maxSize {
+			return strconv.FormatInt(atomic.AddInt64(&generation, 1), 10)
+		}
+		return strconv.FormatInt(atomic.LoadInt64(&generation), 10)
+	}
+}
+
+// Renamer is supposed to move the file specified by src, which has just been rotated out of the head
+// file at path, to the location it is archived at, and return the new path.  src is the same as path
+// unless the file has been moved aside in advance, as RotationQueue does.  The location should be
+// determined by path rather than src.
+type Renamer func(ID, path, src string, ctx interface{}) (string, error)
+
+// Returns a RotationCallback that simply calls the Renamer.
+func (r Renamer) RotationCallback() RotationCallback {
+	return func(ID, path string, ctx interface{}) error {
+		_, err := r(ID, path, path, ctx)
+		return err
+	}
+}
+
+// rotatedFileSuffixes lists the suffixes a rotated file may have in addition to the serial
+// number, so that the compressed variants are shifted together with the others.
+var rotatedFileSuffixes = []string{"", GzipCompression.Extension(), ZlibCompression.Extension(), FlateCompression.Extension()}
+
+func trimRotatedFileSuffix(path string) string {
+	for _, suffix := range rotatedFileSuffixes {
+		if suffix != "" && strings.HasSuffix(path, suffix) {
+			return path[:len(path)-len(suffix)]
+		}
+	}
+	return path
+}
+
 func makeRotatedPath(path string, n int) string {
 	return fmt.Sprintf("%s.%d", path, n)
 }
 
-func makeRoom(basePath string, n int, maxFiles int) (string, error) {
+func existingRotatedFileSuffixes(path string) ([]string, error) {
+	retval := make([]string, 0, 1)
+	for _, suffix := range rotatedFileSuffixes {
+		_, err := os.Stat(path + suffix)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		retval = append(retval, suffix)
+	}
+	return retval, nil
+}
+
+// renameStep is a step of the serial rotation.  The file is removed if To is empty.
+type renameStep struct {
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+}
+
+// Plans the steps to vacate the n-th rotated path, and returns the path along with the steps.
+func planRoom(basePath string, n int, maxFiles int, steps []renameStep) (string, []renameStep, error) {
 	path := makeRotatedPath(basePath, n)
-	_, err := os.Stat(path)
+	suffixes, err := existingRotatedFileSuffixes(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return path, nil
-		}
-		return "", err
+		return "", nil, err
+	}
+	if len(suffixes) == 0 {
+		return path, steps, nil
 	}
 	if n+1 >= maxFiles {
-		err = os.Remove(path)
+		for _, suffix := range suffixes {
+			steps = append(steps, renameStep{From: path + suffix})
+		}
 	} else {
 		var path_ string
-		path_, err = makeRoom(basePath, n+1, maxFiles)
+		path_, steps, err = planRoom(basePath, n+1, maxFiles, steps)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, suffix := range suffixes {
+			steps = append(steps, renameStep{From: path + suffix, To: path_ + suffix})
+		}
+	}
+	return path, steps, nil
+}
+
+// Plans the steps to move src, the file rotated out of the head file, to the first rotated path,
+// which is returned along with them.
+func planSerialRotation(path, src string, maxFiles int) (string, []renameStep, error) {
+	newPath, steps, err := planRoom(path, 0, maxFiles, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return newPath, append(steps, renameStep{From: src, To: newPath}), nil
+}
+
+// renameObservers are notified of the steps SerialRotation has taken, keyed by the head path, so
+// that Manifest can keep track of where the segments have been moved to.
+var (
+	renameObserversMtx sync.Mutex
+	renameObservers    = make(map[string]map[*func(renameStep)]bool)
+)
+
+// Makes f notified of the steps taken for headPath until the returned function is called.
+func observeRenames(headPath string, f func(renameStep)) func() {
+	renameObserversMtx.Lock()
+	defer renameObserversMtx.Unlock()
+	observers, ok := renameObservers[headPath]
+	if !ok {
+		observers = make(map[*func(renameStep)]bool)
+		renameObservers[headPath] = observers
+	}
+	observers[&f] = true
+	return func() {
+		renameObserversMtx.Lock()
+		defer renameObserversMtx.Unlock()
+		delete(observers, &f)
+		if len(observers) == 0 {
+			delete(renameObservers, headPath)
+		}
+	}
+}
+
+func notifyRenamed(headPath string, step renameStep) {
+	renameObserversMtx.Lock()
+	observers := make([]func(renameStep), 0, len(renameObservers[headPath]))
+	for f := range renameObservers[headPath] {
+		observers = append(observers, *f)
+	}
+	renameObserversMtx.Unlock()
+	for _, f := range observers {
+		f(step)
+	}
+}
+
+func (s renameStep) execute(durable bool) error {
+	if s.To == "" {
+		return os.Remove(s.From)
+	}
+	err := os.Rename(s.From, s.To)
+	if err == nil && durable {
+		err = syncDir(s.To)
+	}
+	return err
+}
+
+// SerialRotation moves the head file to the one suffixed by ".0" after shifting the numbers of the
+// files already rotated, until at most MaxFiles files remain.  If Durable is true, the containing
+// directory is synced after each rename so that the renames are committed to the storage in order.
+//
+// If Journal is true, the planned renames are written to a journal file beside the head file before
+// they begin, and the progress is recorded as they proceed, so that the rotation interrupted by a
+// crash can be completed by Recover().  Renamer also completes such a rotation before it starts a
+// new one.
+type SerialRotation struct {
+	MaxFiles int
+	Durable  bool
+	Journal  bool
+}
+
+// Renamer has the same signature as Renamer.  The method value can be used wherever a Renamer is
+// taken.
+func (r SerialRotation) Renamer(_ string, path, src string, _ interface{}) (string, error) {
+	if r.Journal {
+		// the head file has been opened again since, thus it must be left as it is.
+		_, err := r.recover(path, false)
 		if err != nil {
 			return "", err
 		}
-		err = os.Rename(path, path_)
 	}
-	return path, err
+	newPath, steps, err := planSerialRotation(path, src, r.MaxFiles)
+	if err != nil {
+		return "", err
+	}
+	if !r.Journal {
+		for _, step := range steps {
+			err = step.execute(r.Durable)
+			if err != nil {
+				return "", err
+			}
+			notifyRenamed(path, step)
+		}
+		return newPath, nil
+	}
+	return newPath, r.executeJournaled(path, steps)
+}
+
+// RotationCallback has the same signature as RotationCallback.  This does the same as Renamer.
+func (r SerialRotation) RotationCallback(ID, path string, ctx interface{}) error {
+	_, err := r.Renamer(ID, path, path, ctx)
+	return err
+}
+
+func serialRenamer(maxFiles int, durable bool) Renamer {
+	return SerialRotation{MaxFiles: maxFiles, Durable: durable, Journal: false}.Renamer
+}
+
+// This is a factory function that returns a Renamer which does the same as the RotationCallback
+// returned by SerialRotationCallbackFactory, returning the path the file has been moved to.
+// The files compressed by Compressor are taken into account when shifting the numbers.
+func SerialRenamer(maxFiles int) Renamer {
+	return serialRenamer(maxFiles, false)
+}
+
+// This is a factory function that returns a Renamer which does the same as SerialRenamer, except
+// that it syncs the containing directory after each rename so that the renames are committed to
+// the storage in order.
+func DurableSerialRenamer(maxFiles int) Renamer {
+	return serialRenamer(maxFiles, true)
+}
+
+// This is a factory function that returns a Renamer which does the same as SerialRenamer, except
+// that the renames are journaled.  See SerialRotation.
+func JournaledSerialRenamer(maxFiles int) Renamer {
+	return SerialRotation{MaxFiles: maxFiles, Durable: false, Journal: true}.Renamer
 }
 
 // This is a factory function that returns a typical implementation of RotationCallback which
 // move the file specified by path argument to the one suffixed by ".1" after moving the file
 // in the destination path to that with the suffix changed to what the number part is incremented by one
 // (".2" for ".1").  Renaming is done accordingly until at most maxFile number of files remain.
+// The directory is not synced between the renames even if the writer has DurabilityPolicy set; use
+// DurableSerialRotationCallbackFactory for that.
 func SerialRotationCallbackFactory(maxFiles int) RotationCallback {
-	return func(id string, path string, _ interface{}) error {
-		newPath, err := makeRoom(path, 0, maxFiles)
-		if err != nil {
-			return err
-		}
-		return os.Rename(path, newPath)
-	}
+	return SerialRenamer(maxFiles).RotationCallback()
+}
+
+// This is a factory function that returns a RotationCallback which does the same as the one returned
+// by SerialRotationCallbackFactory, except that it syncs the containing directory after each rename.
+func DurableSerialRotationCallbackFactory(maxFiles int) RotationCallback {
+	return DurableSerialRenamer(maxFiles).RotationCallback()
 }
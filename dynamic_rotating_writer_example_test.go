@@ -22,31 +22,13 @@ package ioextras_test
 
 import (
 	"github.com/moriyoshi/go-ioextras"
-	"io"
 	"log"
-	"os"
-	"strconv"
 )
 
 func ExampleDynamicRotatingWriter() {
-	currentId := 0
-	maxSize := int64(4)
-	w := ioextras.NewDynamicRotatingWriter(
-		// IDBuilder
-		func(f io.Writer, _ interface{}) string {
-			_f, ok := f.(*os.File)
-			if !ok {
-				panic("WTF?")
-			}
-			fi, err := _f.Stat()
-			if err != nil {
-				return strconv.Itoa(currentId)
-			}
-			if fi.Size() > maxSize {
-				currentId++
-			}
-			return strconv.Itoa(currentId)
-		},
+	w := ioextras.NewSizeBasedRotatingWriter(
+		// maximum size of a file
+		4,
 		// WriterFactory
 		ioextras.StandardWriterFactory,
 		// HeadPathGenerator
@@ -21,6 +21,7 @@
 package ioextras
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
@@ -68,3 +69,238 @@ func TestDynamicRotatingWriter(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestSizeBasedRotatingWriter(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	err = ioutil.WriteFile(headPath, []byte("xxxxxx\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	w := NewSizeBasedRotatingWriter(
+		10,
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		SerialRotationCallbackFactory(3),
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	w.Write([]byte("ddd\n"))
+	w.Close()
+	expected := map[string][]byte{
+		headPath:        []byte("ccc\nddd\n"),
+		headPath + ".0": []byte("aaa\nbbb\n"),
+		headPath + ".1": []byte("xxxxxx\n"),
+	}
+	for path, content := range expected {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Logf("%v", err)
+			t.Fail()
+			continue
+		}
+		if !bytes.Equal(b, content) {
+			t.Logf("%s: %q", path, b)
+			t.Fail()
+		}
+	}
+}
+
+func TestDynamicRotatingWriterRotateAndReopen(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	rotations := 0
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return "constant"
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		func(id string, path string, ctx interface{}) error {
+			rotations += 1
+			return SerialRotationCallbackFactory(3)(id, path, ctx)
+		},
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	err = w.Rotate(nil)
+	if err != nil || rotations != 1 {
+		t.Logf("%d %v", rotations, err)
+		t.Fail()
+	}
+	w.Write([]byte("bbb\n"))
+	// someone else moves the file away
+	err = os.Rename(headPath, headPath+".moved")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	err = w.Reopen()
+	if err != nil || rotations != 1 {
+		t.Logf("%d %v", rotations, err)
+		t.Fail()
+	}
+	w.Write([]byte("ccc\n"))
+	w.Close()
+	expected := map[string][]byte{
+		headPath:            []byte("ccc\n"),
+		headPath + ".0":     []byte("aaa\n"),
+		headPath + ".moved": []byte("bbb\n"),
+	}
+	for path, content := range expected {
+		b, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Logf("%s: %q %v", path, b, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestDynamicRotatingWriterWatch(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	changed := []string{}
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return "constant"
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		nil,
+		nil,
+	)
+	w.WatchEveryNWrites = 2
+	w.HeadFileChangedCallback = func(path string) {
+		changed = append(changed, path)
+	}
+	w.Write([]byte("aaa\n"))
+	os.Remove(headPath)
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	w.Write([]byte("ddd\n"))
+	w.Close()
+	if len(changed) != 1 || changed[0] != headPath {
+		t.Logf("%v", changed)
+		t.Fail()
+	}
+	b, err := ioutil.ReadFile(headPath)
+	if err != nil || string(b) != "ccc\nddd\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
+
+func TestDynamicRotatingWriterHooks(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	// an existing file that already has the header must not get another one.
+	err = ioutil.WriteFile(headPath, []byte("BEGIN 0\naaa\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	id := "0"
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return id
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		SerialRotationCallbackFactory(3),
+		nil,
+	)
+	w.OnOpen = func(wr io.Writer, path, ID string, _ interface{}) error {
+		_, err := wr.Write([]byte("BEGIN " + ID + "\n"))
+		return err
+	}
+	w.OnClose = func(wr io.Writer, path, ID string, _ interface{}) error {
+		_, err := wr.Write([]byte("END " + ID + "\n"))
+		return err
+	}
+	w.Write([]byte("bbb\n"))
+	id = "1"
+	w.Write([]byte("ccc\n"))
+	if current, _ := w.trackedSizes(); current != int64(len("BEGIN 1\nccc\n")) {
+		t.Logf("%d", current)
+		t.Fail()
+	}
+	w.Close()
+	expected := map[string][]byte{
+		headPath:        []byte("BEGIN 1\nccc\nEND 1\n"),
+		headPath + ".0": []byte("BEGIN 0\naaa\nbbb\nEND 0\n"),
+	}
+	for path, content := range expected {
+		b, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Logf("%s: %q %v", path, b, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestDynamicRotatingWriterHeaderOnNewFile(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	w := NewSizeBasedRotatingWriter(
+		10,
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		SerialRotationCallbackFactory(3),
+		nil,
+	)
+	w.OnOpen = func(wr io.Writer, path, ID string, _ interface{}) error {
+		_, err := wr.Write([]byte("HDR\n"))
+		return err
+	}
+	w.Write([]byte("0123456789"))
+	w.Close()
+	// the header alone must not make a segment.
+	_, err = os.Stat(headPath + ".0")
+	if !os.IsNotExist(err) {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	b, err := ioutil.ReadFile(headPath)
+	if err != nil || string(b) != "HDR\n0123456789" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
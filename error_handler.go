@@ -0,0 +1,261 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrorKind tells at which stage the error reported to ErrorHandler has occurred.
+type ErrorKind int
+
+const (
+	ErrorOnClose ErrorKind = iota
+	ErrorOnReopen
+	ErrorOnCompression
+	ErrorOnRetention
+	ErrorOnFlush
+	ErrorOnSync
+	ErrorOnHook
+	ErrorOnSymlink
+	ErrorOnRotation
+	ErrorOnWrite
+	ErrorOnManifest
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorOnClose:
+		return "close"
+	case ErrorOnReopen:
+		return "reopen"
+	case ErrorOnCompression:
+		return "compression"
+	case ErrorOnRetention:
+		return "retention"
+	case ErrorOnFlush:
+		return "flush"
+	case ErrorOnSync:
+		return "sync"
+	case ErrorOnHook:
+		return "hook"
+	case ErrorOnSymlink:
+		return "symlink"
+	case ErrorOnRotation:
+		return "rotation"
+	case ErrorOnWrite:
+		return "write"
+	case ErrorOnManifest:
+		return "manifest"
+	}
+	return "unknown"
+}
+
+// ErrorHandler receives the errors that cannot be returned to the caller, such as those that occur
+// during closing files.  path is the file the error is about, which may be empty if unknown.
+// HandleError() is never called while the writers hold their locks, thus it may block or call
+// the writers back.
+type ErrorHandler interface {
+	HandleError(kind ErrorKind, path string, err error)
+}
+
+// ErrorHandlerFunc is an adapter to allow the use of ordinary functions as ErrorHandler.
+type ErrorHandlerFunc func(kind ErrorKind, path string, err error)
+
+func (f ErrorHandlerFunc) HandleError(kind ErrorKind, path string, err error) {
+	f(kind, path, err)
+}
+
+// DropErrors is an ErrorHandler that just ignores the errors.
+var DropErrors ErrorHandler = ErrorHandlerFunc(func(ErrorKind, string, error) {})
+
+// LoggingErrorHandler is an ErrorHandler that writes the errors to Logger, or to the standard logger
+// if Logger is nil.
+type LoggingErrorHandler struct {
+	Logger *log.Logger
+}
+
+func (h *LoggingErrorHandler) HandleError(kind ErrorKind, path string, err error) {
+	if h.Logger != nil {
+		h.Logger.Printf("%s error on %s: %v", kind, path, err)
+	} else {
+		log.Printf("%s error on %s: %v", kind, path, err)
+	}
+}
+
+// ErrorReport is what is given to ErrorHandler.
+type ErrorReport struct {
+	Kind  ErrorKind
+	Path  string
+	Error error
+}
+
+// ChannelErrorHandler is an ErrorHandler that sends the errors to the buffered channel C.  The
+// errors are dropped instead of blocking when the buffer is full, and the number of the dropped
+// ones is counted.
+type ChannelErrorHandler struct {
+	// overflows is accessed atomically, and must stay the first field so that it is 64-bit
+	// aligned on 32-bit platforms.
+	overflows uint64
+	C         chan ErrorReport
+}
+
+// Creates a new ChannelErrorHandler whose channel has the buffer of the specified size.
+func NewChannelErrorHandler(size int) *ChannelErrorHandler {
+	return &ChannelErrorHandler{
+		overflows: 0,
+		C:         make(chan ErrorReport, size),
+	}
+}
+
+func (h *ChannelErrorHandler) HandleError(kind ErrorKind, path string, err error) {
+	select {
+	case h.C <- ErrorReport{kind, path, err}:
+	default:
+		atomic.AddUint64(&h.overflows, 1)
+	}
+}
+
+// Returns the number of the errors dropped so far.
+func (h *ChannelErrorHandler) Overflows() uint64 {
+	return atomic.LoadUint64(&h.overflows)
+}
+
+// CollectingErrorHandler is an ErrorHandler that accumulates the errors.
+type CollectingErrorHandler struct {
+	mtx     sync.Mutex
+	reports []ErrorReport
+}
+
+func (h *CollectingErrorHandler) HandleError(kind ErrorKind, path string, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.reports = append(h.reports, ErrorReport{kind, path, err})
+}
+
+// Returns the errors collected so far.
+func (h *CollectingErrorHandler) Reports() []ErrorReport {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return append([]ErrorReport(nil), h.reports...)
+}
+
+func handleError(h ErrorHandler, kind ErrorKind, path string, err error) {
+	if h != nil {
+		h.HandleError(kind, path, err)
+	}
+}
+
+// pendingErrorReport is an error that has occurred while the lock is held.  closer is only set for
+// the errors on close.  handler is only set for the errors deferred by the callbacks, which are
+// reported to it instead of the ErrorHandler of the writer.
+type pendingErrorReport struct {
+	kind    ErrorKind
+	path    string
+	closer  io.Closer
+	err     error
+	handler ErrorHandler
+}
+
+// DeferredErrors is returned by the RotationCallbacks and Renamers of this package when errors that
+// don't fail the rotation, such as those during applying RetentionPolicy, have occurred.  As the
+// callbacks may be called while the rotating writer holds its lock, the errors are carried back to
+// the writer, which reports them to their ErrorHandlers after releasing the lock.  Err is the error
+// that fails the rotation, which is nil if it has succeeded.  Report() has to be called instead when
+// the callback is called directly.
+type DeferredErrors struct {
+	Err     error
+	reports []pendingErrorReport
+}
+
+func (e *DeferredErrors) Error() string {
+	msgs := make([]string, 0, len(e.reports)+1)
+	if e.Err != nil {
+		msgs = append(msgs, e.Err.Error())
+	}
+	for _, r := range e.reports {
+		msgs = append(msgs, fmt.Sprintf("%s error on %s: %v", r.kind, r.path, r.err))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Reports the deferred errors to their ErrorHandlers, and returns Err.
+func (e *DeferredErrors) Report() error {
+	for _, r := range e.reports {
+		r.handler.HandleError(r.kind, r.path, r.err)
+	}
+	return e.Err
+}
+
+// Adds the error to be reported to h later to err, which may be nil or DeferredErrors.  The error is
+// dropped if h is nil, in the same way as handleError().
+func deferError(err error, h ErrorHandler, kind ErrorKind, path string, err_ error) error {
+	if h == nil {
+		return err
+	}
+	e, ok := err.(*DeferredErrors)
+	if !ok {
+		e = &DeferredErrors{Err: err}
+	}
+	e.reports = append(e.reports, pendingErrorReport{kind, path, nil, err_, h})
+	return e
+}
+
+// Splits err into the error that fails the rotation and the deferred ones.
+func splitDeferredErrors(err error) (error, []pendingErrorReport) {
+	e, ok := err.(*DeferredErrors)
+	if !ok {
+		return err, nil
+	}
+	return e.Err, e.reports
+}
+
+// Reports the deferred errors in err right away, and returns the error that fails the rotation.
+func reportDeferredErrors(err error) error {
+	e, ok := err.(*DeferredErrors)
+	if !ok {
+		return err
+	}
+	return e.Report()
+}
+
+// Reports the errors to h.  If h is nil, the close errors are sent to c instead for compatibility.
+// The errors that c is not ready to receive are logged instead of blocking the writer.
+func reportErrors(h ErrorHandler, c chan<- CloserErrorPair, reports []pendingErrorReport) {
+	for _, r := range reports {
+		if r.handler != nil {
+			r.handler.HandleError(r.kind, r.path, r.err)
+		} else if h != nil {
+			h.HandleError(r.kind, r.path, r.err)
+		} else if c != nil && r.kind == ErrorOnClose {
+			select {
+			case c <- CloserErrorPair{r.closer, r.err}:
+			default:
+				log.Printf("%s error on %s: %v (dropped)", r.kind, r.path, r.err)
+			}
+		}
+	}
+}
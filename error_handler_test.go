@@ -0,0 +1,192 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type failingCloser struct{}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+func (failingCloser) Close() error {
+	return errors.New("failed")
+}
+
+func TestErrorHandlerDynamicRotatingWriter(t *testing.T) {
+	count := 0
+	h := NewChannelErrorHandler(1)
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			return &IOCombo{Writer: &bytes.Buffer{}, Closer: failingCloser{}}, nil
+		},
+		func(id string, _ interface{}) string {
+			return id
+		},
+		nil,
+		// nobody receives from this channel, which must not matter as ErrorHandler is set
+		make(chan CloserErrorPair),
+	)
+	w.ErrorHandler = h
+	w.Write([]byte("aaa"))
+	w.Write([]byte("bbb"))
+	w.Write([]byte("ccc"))
+	w.Close()
+	if len(h.C) != 1 || h.Overflows() != 2 {
+		t.Logf("%d %d", len(h.C), h.Overflows())
+		t.FailNow()
+	}
+	r := <-h.C
+	if r.Kind != ErrorOnClose || r.Path != "1" {
+		t.Logf("%v", r)
+		t.Fail()
+	}
+}
+
+func TestErrorHandlerStaticRotatingWriter(t *testing.T) {
+	count := -1
+	h := &CollectingErrorHandler{}
+	// constructed manually, without any channel.
+	w := &StaticRotatingWriter{
+		PathBuilder: func(ctx interface{}) (string, error) {
+			count += 1
+			return strconv.Itoa(count), nil
+		},
+		WriterFactory: func(path string, ctx interface{}) (io.Writer, error) {
+			return &IOCombo{Writer: &bytes.Buffer{}, Closer: failingCloser{}}, nil
+		},
+		ErrorHandler: h,
+	}
+	w.Write([]byte("aaa"))
+	w.Write([]byte("bbb"))
+	w.Close()
+	reports := h.Reports()
+	if len(reports) != 2 || reports[0].Path != "0" || reports[1].Path != "1" {
+		t.Logf("%v", reports)
+		t.Fail()
+	}
+	_, err := w.Write([]byte("ccc"))
+	if err != io.EOF {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+}
+
+func TestUndrainedCloseErrorReportChan(t *testing.T) {
+	count := 0
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			return &IOCombo{Writer: &bytes.Buffer{}, Closer: failingCloser{}}, nil
+		},
+		func(id string, _ interface{}) string {
+			return id
+		},
+		nil,
+		// nobody receives from this channel, and there is no ErrorHandler either.
+		make(chan CloserErrorPair),
+	)
+	done := make(chan struct{})
+	go func() {
+		w.Write([]byte("aaa"))
+		w.Write([]byte("bbb"))
+		w.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Logf("Close() blocked on the undrained channel")
+		t.Fail()
+	}
+}
+
+func TestReentrantErrorHandlerOnRotation(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	id := "1"
+	var w *DynamicRotatingWriter
+	// the errors are written back to the writer.
+	h := &LoggingErrorHandler{Logger: log.New(writerFunc(func(b []byte) (int, error) {
+		return w.Write(b)
+	}), "", 0)}
+	// the broken pattern makes the policy fail every time.
+	rp := &RetentionPolicy{Glob: "[", ErrorHandler: h}
+	m := NewManifest(filepath.Join(baseDir, "nonexistent", "MANIFEST"), h)
+	w = NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return id
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		rp.RotationCallback(m.Renamer(SerialRenamer(5)).RotationCallback()),
+		nil,
+	)
+	done := make(chan struct{})
+	go func() {
+		w.Write([]byte("aaa\n"))
+		id = "2"
+		w.Write([]byte("bbb\n"))
+		id = "3"
+		w.Write([]byte("ccc\n"))
+		w.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Logf("the error handler has been called under the lock")
+		t.FailNow()
+	}
+	b, err := ioutil.ReadFile(headPath)
+	if err != nil || !bytes.Contains(b, []byte("retention error on "+headPath)) || !bytes.Contains(b, []byte("manifest error on ")) {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
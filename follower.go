@@ -0,0 +1,204 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultPollInterval is the interval Follower checks the file at when PollInterval is zero.
+const DefaultPollInterval = 250 * time.Millisecond
+
+// Follower reads the file at Path as it grows, in the same way as "tail -F" does.  When the file is
+// renamed or removed by rotation and another is created at Path, the rest of the old file is read
+// before the new one is opened.  When the file gets truncated, it is read from the beginning again.
+// The changes are detected by polling every PollInterval.
+//
+// Read() blocks until some data is available or the context given to NewFollower is done, in which
+// case the error of the context is returned.
+type Follower struct {
+	Path         string
+	PollInterval time.Duration
+	ctx          context.Context
+	fromStart    bool
+	file         *os.File
+	fileInfo     os.FileInfo
+	offset       int64
+}
+
+// Creates a new Follower.  The first file is read from the beginning if fromStart is true, and from
+// the end otherwise, unless it doesn't exist yet.  The files that show up afterwards are always read
+// from the beginning.  ctx
+// can be nil, in which case context.Background() is used.
+func NewFollower(ctx context.Context, path string, fromStart bool) *Follower {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Follower{
+		Path:         path,
+		PollInterval: DefaultPollInterval,
+		ctx:          ctx,
+		fromStart:    fromStart,
+	}
+}
+
+// Name() method of Named interface.  Returns the path to the file being followed.
+func (f *Follower) Name() string {
+	return f.Path
+}
+
+// Returns the offset in the file being read right after the data most recently read.
+func (f *Follower) Offset() int64 {
+	return f.offset
+}
+
+func (f *Follower) open() error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the file that shows up later has to be read from the beginning.
+			f.fromStart = true
+		}
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	offset := int64(0)
+	if !f.fromStart {
+		offset, err = file.Seek(0, io.SeekEnd)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	f.file, f.fileInfo, f.offset = file, fi, offset
+	// only the first file may be skipped.
+	f.fromStart = true
+	return nil
+}
+
+// Tells if the file at Path is no longer the one being read.
+func (f *Follower) replaced() (bool, error) {
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return !os.SameFile(f.fileInfo, fi), nil
+}
+
+func (f *Follower) wait(ctx context.Context) error {
+	interval := f.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Read() method of io.Reader interface.  This calls ReadContext() with the context given to
+// NewFollower.
+func (f *Follower) Read(b []byte) (int, error) {
+	return f.ReadContext(f.ctx, b)
+}
+
+// Reads the data from the file being followed, waiting for some to be available until ctx is done.
+func (f *Follower) ReadContext(ctx context.Context, b []byte) (int, error) {
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+		if f.file == nil {
+			err = f.open()
+			if err != nil {
+				if !os.IsNotExist(err) {
+					return 0, err
+				}
+				err = f.wait(ctx)
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		n, err := f.file.Read(b)
+		f.offset += int64(n)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		replaced, err := f.replaced()
+		if err != nil {
+			return 0, err
+		}
+		if replaced {
+			// read what has been written before the file was replaced.
+			n, err = f.file.Read(b)
+			f.offset += int64(n)
+			if n > 0 || (err != nil && err != io.EOF) {
+				return n, err
+			}
+			f.file.Close()
+			f.file = nil
+			continue
+		}
+		fi, err := f.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fi.Size() < f.offset {
+			// truncated
+			f.offset, err = f.file.Seek(0, io.SeekStart)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		err = f.wait(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Closes the file being read.
+func (f *Follower) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollower(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	err = ioutil.WriteFile(headPath, []byte("old\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := NewFollower(ctx, headPath, false)
+	f.PollInterval = time.Millisecond
+	defer f.Close()
+	received := make(chan string)
+	go func() {
+		defer close(received)
+		b := make([]byte, 16)
+		for {
+			n, err := f.Read(b)
+			if err != nil {
+				received <- err.Error()
+				return
+			}
+			received <- string(b[:n])
+		}
+	}()
+	expect := func(expected string) {
+		s := ""
+		for len(s) < len(expected) {
+			select {
+			case r := <-received:
+				s += r
+			case <-time.After(5 * time.Second):
+				t.Logf("timed out: %q", s)
+				t.FailNow()
+			}
+		}
+		if s != expected {
+			t.Logf("%q", s)
+			t.Fail()
+		}
+	}
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return "constant"
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		SerialRotationCallbackFactory(3),
+		nil,
+	)
+	defer w.Close()
+	// wait for the follower to open the file.
+	time.Sleep(10 * time.Millisecond)
+	w.Write([]byte("aaa\n"))
+	expect("aaa\n")
+	w.Write([]byte("bbb\n"))
+	w.Rotate(nil)
+	w.Write([]byte("ccc\n"))
+	expect("bbb\nccc\n")
+	// truncated by someone else
+	err = os.Truncate(headPath, 0)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	time.Sleep(10 * time.Millisecond)
+	f_, err := os.OpenFile(headPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	f_.Write([]byte("ddd\n"))
+	f_.Close()
+	expect("ddd\n")
+	cancel()
+	expect(context.Canceled.Error())
+}
+
+func TestFollowerFileShowingUpLater(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the file doesn't exist yet, thus it is read from the beginning in spite of fromStart.
+	f := NewFollower(ctx, headPath, false)
+	f.PollInterval = time.Millisecond
+	defer f.Close()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ioutil.WriteFile(headPath, []byte("aaa\n"), os.FileMode(0666))
+	}()
+	b, err := ioutil.ReadAll(io.LimitReader(f, 4))
+	if err != nil || string(b) != "aaa\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
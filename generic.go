@@ -0,0 +1,247 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.18
+// +build go1.18
+
+package ioextras
+
+import (
+	"fmt"
+	"io"
+)
+
+// ContextualWriterOf is the typed counterpart of ContextualWriter.
+type ContextualWriterOf[C any] interface {
+	WriteWithCtx([]byte, C) (int, error)
+}
+
+// The typed counterparts of IDBuilder, HeadPathGenerator, WriterFactory, PathBuilder and
+// RotationCallback respectively.  Each of them has Untyped() method that converts it to the untyped
+// one, and Typed* function does the opposite.  The untyped WriterFactory, PathBuilder and
+// RotationCallback fail when ctx is neither nil nor of type C, as UntypedWriter does, while the
+// untyped IDBuilder and HeadPathGenerator, which have no way to report an error, pass the zero value
+// of C instead.
+type IDBuilderOf[C any] func(w io.Writer, ctx C) string
+type HeadPathGeneratorOf[C any] func(ID string, ctx C) string
+type WriterFactoryOf[C any] func(path string, ctx C) (io.Writer, error)
+type PathBuilderOf[C any] func(ctx C) (string, error)
+type RotationCallbackOf[C any] func(ID, path string, ctx C) error
+
+// Converts the untyped ctx passed by the writers back to C.  The writers pass nil where no ctx is
+// available, like on Close(), which is converted to the zero value.  ctx of any other type is an
+// error, in the same way as UntypedWriter.
+func contextOf[C any](ctx interface{}) (C, error) {
+	var zero C
+	if ctx == nil {
+		return zero, nil
+	}
+	c, ok := ctx.(C)
+	if !ok {
+		return zero, fmt.Errorf("ctx of type %T is given where %T is expected", ctx, zero)
+	}
+	return c, nil
+}
+
+func (f IDBuilderOf[C]) Untyped() IDBuilder {
+	if f == nil {
+		return nil
+	}
+	return func(w io.Writer, ctx interface{}) string {
+		c, _ := contextOf[C](ctx)
+		return f(w, c)
+	}
+}
+
+func (f HeadPathGeneratorOf[C]) Untyped() HeadPathGenerator {
+	if f == nil {
+		return nil
+	}
+	return func(ID string, ctx interface{}) string {
+		c, _ := contextOf[C](ctx)
+		return f(ID, c)
+	}
+}
+
+func (f WriterFactoryOf[C]) Untyped() WriterFactory {
+	if f == nil {
+		return nil
+	}
+	return func(path string, ctx interface{}) (io.Writer, error) {
+		c, err := contextOf[C](ctx)
+		if err != nil {
+			return nil, err
+		}
+		return f(path, c)
+	}
+}
+
+func (f PathBuilderOf[C]) Untyped() PathBuilder {
+	if f == nil {
+		return nil
+	}
+	return func(ctx interface{}) (string, error) {
+		c, err := contextOf[C](ctx)
+		if err != nil {
+			return "", err
+		}
+		return f(c)
+	}
+}
+
+func (f RotationCallbackOf[C]) Untyped() RotationCallback {
+	if f == nil {
+		return nil
+	}
+	return func(ID, path string, ctx interface{}) error {
+		c, err := contextOf[C](ctx)
+		if err != nil {
+			return err
+		}
+		return f(ID, path, c)
+	}
+}
+
+func TypedIDBuilder[C any](f IDBuilder) IDBuilderOf[C] {
+	if f == nil {
+		return nil
+	}
+	return func(w io.Writer, ctx C) string {
+		return f(w, ctx)
+	}
+}
+
+func TypedHeadPathGenerator[C any](f HeadPathGenerator) HeadPathGeneratorOf[C] {
+	if f == nil {
+		return nil
+	}
+	return func(ID string, ctx C) string {
+		return f(ID, ctx)
+	}
+}
+
+func TypedWriterFactory[C any](f WriterFactory) WriterFactoryOf[C] {
+	if f == nil {
+		return nil
+	}
+	return func(path string, ctx C) (io.Writer, error) {
+		return f(path, ctx)
+	}
+}
+
+func TypedPathBuilder[C any](f PathBuilder) PathBuilderOf[C] {
+	if f == nil {
+		return nil
+	}
+	return func(ctx C) (string, error) {
+		return f(ctx)
+	}
+}
+
+func TypedRotationCallback[C any](f RotationCallback) RotationCallbackOf[C] {
+	if f == nil {
+		return nil
+	}
+	return func(ID, path string, ctx C) error {
+		return f(ID, path, ctx)
+	}
+}
+
+type typedWriter[C any] struct {
+	w ContextualWriter
+}
+
+func (w typedWriter[C]) WriteWithCtx(b []byte, ctx C) (int, error) {
+	return w.w.WriteWithCtx(b, ctx)
+}
+
+// Returns a ContextualWriterOf that passes ctx to w as it is.
+func TypedWriter[C any](w ContextualWriter) ContextualWriterOf[C] {
+	return typedWriter[C]{w}
+}
+
+type untypedWriter[C any] struct {
+	w ContextualWriterOf[C]
+}
+
+func (w untypedWriter[C]) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
+	c, err := contextOf[C](ctx)
+	if err != nil {
+		return 0, err
+	}
+	return w.w.WriteWithCtx(b, c)
+}
+
+// Returns a ContextualWriter that passes ctx to w.  The writes with ctx that is neither nil nor of
+// type C fail.  nil is passed to w as the zero value of C.
+func UntypedWriter[C any](w ContextualWriterOf[C]) ContextualWriter {
+	return untypedWriter[C]{w}
+}
+
+// DynamicRotatingWriterOf is a DynamicRotatingWriter whose callbacks receive ctx of type C.  The
+// untyped writer is embedded, so that the rest of its fields and methods are available as they are.
+type DynamicRotatingWriterOf[C any] struct {
+	*DynamicRotatingWriter
+}
+
+// Creates a new DynamicRotatingWriterOf.  See NewDynamicRotatingWriter for the arguments.
+func NewDynamicRotatingWriterOf[C any](idBuilder IDBuilderOf[C], writerFactory WriterFactoryOf[C], headPathGenerator HeadPathGeneratorOf[C], rotationCallback RotationCallbackOf[C], closeErrorReportChan chan<- CloserErrorPair) *DynamicRotatingWriterOf[C] {
+	return &DynamicRotatingWriterOf[C]{
+		DynamicRotatingWriter: NewDynamicRotatingWriter(
+			idBuilder.Untyped(),
+			writerFactory.Untyped(),
+			headPathGenerator.Untyped(),
+			rotationCallback.Untyped(),
+			closeErrorReportChan,
+		),
+	}
+}
+
+// WriteWithCtx() method of ContextualWriterOf interface.
+func (w *DynamicRotatingWriterOf[C]) WriteWithCtx(b []byte, ctx C) (int, error) {
+	return w.DynamicRotatingWriter.WriteWithCtx(b, ctx)
+}
+
+// Forces rotation regardless of the ID.  See DynamicRotatingWriter.Rotate().
+func (w *DynamicRotatingWriterOf[C]) Rotate(ctx C) error {
+	return w.DynamicRotatingWriter.Rotate(ctx)
+}
+
+// StaticRotatingWriterOf is a StaticRotatingWriter whose callbacks receive ctx of type C.  The
+// untyped writer is embedded, so that the rest of its fields and methods are available as they are.
+type StaticRotatingWriterOf[C any] struct {
+	*StaticRotatingWriter
+}
+
+// Creates a new StaticRotatingWriterOf.  See NewStaticRotatingWriter for the arguments.
+func NewStaticRotatingWriterOf[C any](pathBuilder PathBuilderOf[C], writerFactory WriterFactoryOf[C], closeErrorReportChan chan<- CloserErrorPair) *StaticRotatingWriterOf[C] {
+	return &StaticRotatingWriterOf[C]{
+		StaticRotatingWriter: NewStaticRotatingWriter(
+			pathBuilder.Untyped(),
+			writerFactory.Untyped(),
+			closeErrorReportChan,
+		),
+	}
+}
+
+// WriteWithCtx() method of ContextualWriterOf interface.
+func (w *StaticRotatingWriterOf[C]) WriteWithCtx(b []byte, ctx C) (int, error) {
+	return w.StaticRotatingWriter.WriteWithCtx(b, ctx)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.18
+// +build go1.18
+
+package ioextras
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type logCtx struct {
+	tenant string
+	cycle  string
+}
+
+func TestDynamicRotatingWriterOf(t *testing.T) {
+	writers := map[string]*bytes.Buffer{}
+	rotated := []string(nil)
+	w := NewDynamicRotatingWriterOf[*logCtx](
+		func(_ io.Writer, ctx *logCtx) string {
+			if ctx == nil {
+				return ""
+			}
+			return ctx.cycle
+		},
+		func(path string, _ *logCtx) (io.Writer, error) {
+			writers[path] = &bytes.Buffer{}
+			return writers[path], nil
+		},
+		func(ID string, ctx *logCtx) string {
+			return ctx.tenant + "." + ID
+		},
+		func(ID, path string, ctx *logCtx) error {
+			rotated = append(rotated, path)
+			return nil
+		},
+		nil,
+	)
+	w.WriteWithCtx([]byte("aaa"), &logCtx{"x", "1"})
+	w.WriteWithCtx([]byte("bbb"), &logCtx{"x", "2"})
+	// the untyped API can still be used
+	UntypedWriter[*logCtx](w).WriteWithCtx([]byte("ccc"), &logCtx{"x", "2"})
+	_, err := UntypedWriter[*logCtx](w).WriteWithCtx([]byte("ddd"), "x")
+	if err == nil {
+		t.Logf("the ctx of a wrong type has been accepted")
+		t.Fail()
+	}
+	w.Close()
+	if writers["x.1"].String() != "aaa" || writers["x.2"].String() != "bbbccc" {
+		t.Logf("%v", writers)
+		t.Fail()
+	}
+	if len(rotated) != 1 || rotated[0] != "x.1" {
+		t.Logf("%v", rotated)
+		t.Fail()
+	}
+}
+
+func TestStaticRotatingWriterOf(t *testing.T) {
+	writers := map[string]*bytes.Buffer{}
+	w := NewStaticRotatingWriterOf[string](
+		func(ctx string) (string, error) {
+			return ctx, nil
+		},
+		TypedWriterFactory[string](func(path string, _ interface{}) (io.Writer, error) {
+			writers[path] = &bytes.Buffer{}
+			return writers[path], nil
+		}),
+		nil,
+	)
+	var cw ContextualWriterOf[string] = w
+	cw.WriteWithCtx([]byte("aaa"), "a")
+	TypedWriter[string](w.StaticRotatingWriter).WriteWithCtx([]byte("bbb"), "b")
+	w.Close()
+	if writers["a"].String() != "aaa" || writers["b"].String() != "bbb" {
+		t.Logf("%v", writers)
+		t.Fail()
+	}
+}
+
+func TestUntypedCallbacksOf(t *testing.T) {
+	pathBuilder := PathBuilderOf[string](func(ctx string) (string, error) {
+		return "path." + ctx, nil
+	}).Untyped()
+	path, err := pathBuilder("a")
+	if err != nil || path != "path.a" {
+		t.Logf("%s %v", path, err)
+		t.Fail()
+	}
+	// nil is the zero value.
+	path, err = pathBuilder(nil)
+	if err != nil || path != "path." {
+		t.Logf("%s %v", path, err)
+		t.Fail()
+	}
+	_, err = pathBuilder(1)
+	if err == nil {
+		t.Logf("the ctx of a wrong type has been accepted")
+		t.Fail()
+	}
+	err = RotationCallbackOf[string](func(_, _ string, _ string) error {
+		return nil
+	}).Untyped()("1", "path", 1)
+	if err == nil {
+		t.Logf("the ctx of a wrong type has been accepted")
+		t.Fail()
+	}
+	_, err = WriterFactoryOf[string](func(_ string, _ string) (io.Writer, error) {
+		return &bytes.Buffer{}, nil
+	}).Untyped()("path", 1)
+	if err == nil {
+		t.Logf("the ctx of a wrong type has been accepted")
+		t.Fail()
+	}
+	// IDBuilder can't fail.
+	ID := IDBuilderOf[string](func(_ io.Writer, ctx string) string {
+		return "id." + ctx
+	}).Untyped()(nil, 1)
+	if ID != "id." {
+		t.Logf("%s", ID)
+		t.Fail()
+	}
+}
@@ -20,6 +20,8 @@
 
 package ioextras
 
+import "context"
+
 // Defines a writer interface accompanied by the opaque context information
 type ContextualWriter interface {
 	WriteWithCtx([]byte, interface{}) (int, error)
@@ -30,6 +32,16 @@ type ContextualReader interface {
 	ReadWithCtx([]byte, interface{}) (int, error)
 }
 
+// ReaderContext is a reader whose reads can be cancelled through context.Context.
+type ReaderContext interface {
+	ReadContext(context.Context, []byte) (int, error)
+}
+
+// WriterContext is a writer whose writes can be cancelled through context.Context.
+type WriterContext interface {
+	WriteContext(context.Context, []byte) (int, error)
+}
+
 // Flusher is an I/O channel (or stream) that provides `Flush` operation.
 type Flusher interface {
 	Flush() error
@@ -44,3 +56,14 @@ type Sized interface {
 type Named interface {
 	Name() string
 }
+
+// Reopener is an I/O channel that is able to close the underlying files and open them again.
+type Reopener interface {
+	Reopen() error
+}
+
+// DoneNotifier is an I/O channel that tells when it gets closed by closing the channel returned by
+// Done().
+type DoneNotifier interface {
+	Done() <-chan struct{}
+}
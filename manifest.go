@@ -0,0 +1,343 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCorrupted is the error reported by Manifest.Verify() for a segment whose content doesn't match
+// the manifest.
+var ErrCorrupted = errors.New("segment does not match the manifest")
+
+// ManifestEntry describes a segment, that is, a file rotated out of a head file.  Path is where the
+// segment has been moved to, relative to the directory containing the manifest if it is under there.
+// Bytes and SHA256 are those of the uncompressed content.  FirstWrite is zero unless Manifest.OnOpen
+// has been called for the segment.  Removed tells the segment has been removed or overwritten since,
+// which is not recorded but derived by Manifest.Entries().
+type ManifestEntry struct {
+	Path       string    `json:"path"`
+	ID         string    `json:"id"`
+	Bytes      int64     `json:"bytes"`
+	FirstWrite time.Time `json:"first_write"`
+	LastWrite  time.Time `json:"last_write"`
+	SHA256     string    `json:"sha256"`
+	Removed    bool      `json:"-"`
+}
+
+// manifestMove is the move of a segment, or its removal if To is empty.
+type manifestMove struct {
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+}
+
+// manifestRecord is a line of the manifest, which is either an entry or a move.
+type manifestRecord struct {
+	ManifestEntry
+	Move *manifestMove `json:"move,omitempty"`
+}
+
+type manifestMoveRecord struct {
+	Move manifestMove `json:"move"`
+}
+
+// ManifestProblem is a segment Manifest.Verify() has found missing or corrupted.
+type ManifestProblem struct {
+	Entry ManifestEntry
+	Err   error
+}
+
+// Manifest appends an entry for every segment to the file at Path, one JSON object per line.  Renamer()
+// wraps the Renamer that moves the segments, so that any naming scheme can be used.  The segment is
+// checksummed before it is passed to the Renamer, which can thus be Compressor.Rename.  As it is read
+// as a whole in the rotation, RotationQueue should be used for large segments so that the writer is
+// not blocked meanwhile.  The moves of the segments done by SerialRenamer on the later rotations are
+// recorded too, so that Entries() returns the paths they end up at.
+//
+// OnOpen can be set to the OnOpen hook of DynamicRotatingWriter, so that the time the first write to
+// the segment happened is recorded.  If Durable is true, the manifest is synced after every append.
+// Errors that occur during recording are reported to ErrorHandler with ErrorOnManifest through
+// DeferredErrors, and never fail the rotation.
+type Manifest struct {
+	Path         string
+	Durable      bool
+	ErrorHandler ErrorHandler
+	mtx          sync.Mutex
+	firstWrites  map[string]time.Time
+}
+
+// Creates a new Manifest.  errorHandler can be nil.
+func NewManifest(path string, errorHandler ErrorHandler) *Manifest {
+	return &Manifest{
+		Path:         path,
+		Durable:      false,
+		ErrorHandler: errorHandler,
+		mtx:          sync.Mutex{},
+		firstWrites:  make(map[string]time.Time),
+	}
+}
+
+func firstWriteKey(path, ID string) string {
+	return path + "\x00" + ID
+}
+
+// OnOpen has the same signature as FileHook.  This records the time the new file is opened at as the
+// time of the first write to it.
+func (m *Manifest) OnOpen(_ io.Writer, path, ID string, _ interface{}) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.firstWrites == nil {
+		m.firstWrites = make(map[string]time.Time)
+	}
+	m.firstWrites[firstWriteKey(path, ID)] = time.Now()
+	return nil
+}
+
+// Returns a Renamer that records the segment to the manifest around calling next.
+func (m *Manifest) Renamer(next Renamer) Renamer {
+	return func(ID, path, src string, ctx interface{}) (string, error) {
+		m.mtx.Lock()
+		key := firstWriteKey(path, ID)
+		firstWrite := m.firstWrites[key]
+		delete(m.firstWrites, key)
+		m.mtx.Unlock()
+		entry, checksumErr := checksumSegment(src)
+		var movesMtx sync.Mutex
+		records := []interface{}(nil)
+		stopObserving := observeRenames(path, func(step renameStep) {
+			if step.From == src {
+				// the segment itself, which is recorded below.
+				return
+			}
+			move := manifestMove{From: m.relPath(step.From)}
+			if step.To != "" {
+				move.To = m.relPath(step.To)
+			}
+			movesMtx.Lock()
+			records = append(records, manifestMoveRecord{move})
+			movesMtx.Unlock()
+		})
+		newPath, err := next(ID, path, src, ctx)
+		stopObserving()
+		if checksumErr != nil {
+			err = deferError(err, m.ErrorHandler, ErrorOnManifest, src, checksumErr)
+		} else if fatal, _ := splitDeferredErrors(err); fatal == nil {
+			entry.Path = m.relPath(newPath)
+			entry.ID = ID
+			entry.FirstWrite = firstWrite
+			records = append(records, entry)
+		}
+		// the moves are recorded even if the rotation has failed halfway.
+		err_ := m.append(records...)
+		if err_ != nil {
+			err = deferError(err, m.ErrorHandler, ErrorOnManifest, m.Path, err_)
+		}
+		return newPath, err
+	}
+}
+
+func checksumSegment(path string) (ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{
+		Bytes:     n,
+		LastWrite: fi.ModTime(),
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+func (m *Manifest) relPath(path string) string {
+	absDir, err := filepath.Abs(filepath.Dir(m.Path))
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return absPath
+	}
+	return rel
+}
+
+func (m *Manifest) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(m.Path), path)
+}
+
+func (m *Manifest) append(records ...interface{}) error {
+	if len(records) == 0 {
+		return nil
+	}
+	b := []byte(nil)
+	for _, record := range records {
+		b_, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, b_...), '\n')
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.FileMode(0666))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err == nil && m.Durable {
+		err = f.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Returns the entries recorded in the manifest, oldest first, with the moves recorded afterwards
+// applied.
+func (m *Manifest) Entries() ([]ManifestEntry, error) {
+	f, err := os.Open(m.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	entries := []ManifestEntry(nil)
+	// the entry of the segment currently at each path.
+	at := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		record := manifestRecord{}
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return entries, fmt.Errorf("%s:%d: %v", m.Path, line, err)
+		}
+		if record.Move == nil {
+			if i, ok := at[record.Path]; ok {
+				entries[i].Removed = true
+			}
+			at[record.Path] = len(entries)
+			entries = append(entries, record.ManifestEntry)
+			continue
+		}
+		i, ok := at[record.Move.From]
+		if !ok {
+			continue
+		}
+		delete(at, record.Move.From)
+		if record.Move.To == "" {
+			entries[i].Removed = true
+			continue
+		}
+		if j, ok := at[record.Move.To]; ok {
+			entries[j].Removed = true
+		}
+		entries[i].Path = record.Move.To
+		at[record.Move.To] = i
+	}
+	return entries, scanner.Err()
+}
+
+// Recomputes the checksums of the segments in the manifest, and returns the ones that are missing or
+// corrupted.  Err of a missing segment satisfies os.IsNotExist(), and that of a corrupted one is
+// ErrCorrupted.  The compressed segments are decompressed to be verified.  The segments removed by
+// SerialRenamer once they got too old are reported missing.
+func (m *Manifest) Verify() ([]ManifestProblem, error) {
+	entries, err := m.Entries()
+	if err != nil {
+		return nil, err
+	}
+	problems := []ManifestProblem(nil)
+	for _, entry := range entries {
+		path := m.resolvePath(entry.Path)
+		var err error
+		if entry.Removed {
+			err = &os.PathError{Op: "verify", Path: path, Err: os.ErrNotExist}
+		} else {
+			err = verifySegment(path, entry)
+		}
+		if err != nil {
+			problems = append(problems, ManifestProblem{entry, err})
+		}
+	}
+	return problems, nil
+}
+
+func verifySegment(path string, entry ManifestEntry) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := io.Reader(f)
+	c, ok := compressionOf(path)
+	if ok {
+		rc, err := c.newReader(f)
+		if err != nil {
+			return ErrCorrupted
+		}
+		defer rc.Close()
+		r = rc
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return err
+		}
+		// the compressed stream is broken.
+		return ErrCorrupted
+	}
+	if n != entry.Bytes || hex.EncodeToString(h.Sum(nil)) != entry.SHA256 {
+		return ErrCorrupted
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	m := NewManifest(filepath.Join(baseDir, "MANIFEST"), nil)
+	c := NewCompressor(IDSuffixRenamer(), GzipCompression, nil)
+	count := 0
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		m.Renamer(c.Rename).RotationCallback(),
+		nil,
+	)
+	w.OnOpen = m.OnOpen
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bb\n"))
+	w.Write([]byte("c\n"))
+	w.Close()
+	c.Wait()
+	entries, err := m.Entries()
+	if err != nil || len(entries) != 2 {
+		t.Logf("%v %v", entries, err)
+		t.FailNow()
+	}
+	if entries[0].Path != "TEST.1.gz" || entries[0].ID != "1" || entries[0].Bytes != 4 || entries[0].FirstWrite.IsZero() || entries[0].LastWrite.IsZero() {
+		t.Logf("%+v", entries[0])
+		t.Fail()
+	}
+	if entries[1].Path != "TEST.2.gz" || entries[1].ID != "2" || entries[1].Bytes != 3 {
+		t.Logf("%+v", entries[1])
+		t.Fail()
+	}
+	problems, err := m.Verify()
+	if err != nil || len(problems) != 0 {
+		t.Logf("%v %v", problems, err)
+		t.Fail()
+	}
+	err = ioutil.WriteFile(headPath+".1.gz", []byte("garbage"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	err = os.Remove(headPath + ".2.gz")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	problems, err = m.Verify()
+	if err != nil || len(problems) != 2 || problems[0].Err != ErrCorrupted || !os.IsNotExist(problems[1].Err) {
+		t.Logf("%v %v", problems, err)
+		t.Fail()
+	}
+}
+
+func TestManifestSerialRenamer(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	m := NewManifest(filepath.Join(baseDir, "MANIFEST"), nil)
+	count := 0
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		m.Renamer(SerialRenamer(3)).RotationCallback(),
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bb\n"))
+	w.Write([]byte("c\n"))
+	w.Write([]byte("dddd\n"))
+	w.Write([]byte("eeeee\n"))
+	w.Close()
+	entries, err := m.Entries()
+	if err != nil || len(entries) != 4 {
+		t.Logf("%v %v", entries, err)
+		t.FailNow()
+	}
+	// the segments have been shifted after they were recorded, and the oldest has been dropped.
+	expected := []ManifestEntry{
+		{Path: "TEST.2", ID: "1", Removed: true},
+		{Path: "TEST.2", ID: "2"},
+		{Path: "TEST.1", ID: "3"},
+		{Path: "TEST.0", ID: "4"},
+	}
+	for i, entry := range entries {
+		if entry.Path != expected[i].Path || entry.ID != expected[i].ID || entry.Removed != expected[i].Removed {
+			t.Logf("%d: %+v", i, entry)
+			t.Fail()
+		}
+	}
+	problems, err := m.Verify()
+	if err != nil || len(problems) != 1 || problems[0].Entry.ID != "1" || !os.IsNotExist(problems[0].Err) {
+		t.Logf("%v %v", problems, err)
+		t.Fail()
+	}
+	err = ioutil.WriteFile(headPath+".1", []byte("garbage"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	problems, err = m.Verify()
+	if err != nil || len(problems) != 2 || problems[1].Entry.ID != "3" || problems[1].Err != ErrCorrupted {
+		t.Logf("%v %v", problems, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// RecordWriter accumulates the written data until a record is complete, and then hands the record to
+// Writer by a single call to WriteWithCtx(), so that a record that arrives in pieces, for example
+// through bufio.Writer or json.Encoder, never straddles a rotation boundary of DynamicRotatingWriter.
+//
+// Records are delimited by Split in the same manner as bufio.Scanner does; the number of bytes
+// Split advances by is taken as the length of the record, and the token is not used, thus the data
+// is passed through as it is, delimiters included.  When the pending data grows past MaxRecordSize
+// bytes without a delimiter, it is handed over as it is if MaxRecordSize is positive.
+//
+// The ctx of the write that completes a record is passed along with it.  The incomplete record left
+// in the buffer is written on Close().
+type RecordWriter struct {
+	Writer        ContextualWriter
+	Split         bufio.SplitFunc
+	MaxRecordSize int
+	mtx           sync.Mutex
+	buf           []byte
+	lastCtx       interface{}
+}
+
+// Creates a new RecordWriter.  split can be nil, in which case bufio.ScanLines is used.
+func NewRecordWriter(w ContextualWriter, split bufio.SplitFunc) *RecordWriter {
+	if split == nil {
+		split = bufio.ScanLines
+	}
+	return &RecordWriter{
+		Writer:        w,
+		Split:         split,
+		MaxRecordSize: 0,
+		mtx:           sync.Mutex{},
+		buf:           nil,
+		lastCtx:       nil,
+	}
+}
+
+// Write() method of io.Writer() interface.  This simply calls WriteWithCtx() with the second argument
+// being nil.
+func (w *RecordWriter) Write(b []byte) (int, error) {
+	return w.WriteWithCtx(b, nil)
+}
+
+// WriteWithCtx() method of ContextualWriter interface.  The complete records are written to Writer
+// before this returns, and the rest is kept until the record gets complete.  If the write to Writer
+// fails, the number of bytes of b that has been written or remains buffered is returned.
+func (w *RecordWriter) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	pre := len(w.buf)
+	w.buf = append(w.buf, b...)
+	w.lastCtx = ctx
+	off, err := w.writeRecords(ctx, false)
+	if err != nil {
+		// b is consumed only up to the point where the write has failed.
+		n := off - pre
+		if n < 0 {
+			n = 0
+			w.buf = w.buf[off:pre]
+		} else {
+			w.buf = w.buf[:0]
+		}
+		return n, err
+	}
+	w.buf = append(w.buf[:0], w.buf[off:]...)
+	return len(b), nil
+}
+
+// Writes the complete records in the buffer, and returns the number of bytes written.
+func (w *RecordWriter) writeRecords(ctx interface{}, atEOF bool) (int, error) {
+	split := w.Split
+	if split == nil {
+		split = bufio.ScanLines
+	}
+	off := 0
+	for off < len(w.buf) {
+		advance, _, err := split(w.buf[off:], atEOF)
+		if err != nil {
+			return off, err
+		}
+		if advance <= 0 {
+			rest := len(w.buf) - off
+			if !atEOF && (w.MaxRecordSize <= 0 || rest <= w.MaxRecordSize) {
+				break
+			}
+			advance = rest
+		}
+		if advance > len(w.buf)-off {
+			return off, bufio.ErrAdvanceTooFar
+		}
+		n, err := w.Writer.WriteWithCtx(w.buf[off:off+advance], ctx)
+		off += n
+		if err != nil {
+			return off, err
+		}
+		if n < advance {
+			return off, io.ErrShortWrite
+		}
+	}
+	return off, nil
+}
+
+// Returns the number of bytes of the incomplete record being buffered.
+func (w *RecordWriter) Buffered() int {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return len(w.buf)
+}
+
+// Flush() method of Flusher interface.  This flushes Writer if it implements Flusher.  The incomplete
+// record is kept in the buffer.
+func (w *RecordWriter) Flush() error {
+	f, ok := w.Writer.(Flusher)
+	if !ok {
+		return nil
+	}
+	return f.Flush()
+}
+
+// Writes the incomplete record, if any, with the ctx of the last write, and then closes Writer if it
+// implements io.Closer.
+func (w *RecordWriter) Close() error {
+	w.mtx.Lock()
+	_, err := w.writeRecords(w.lastCtx, true)
+	w.buf = nil
+	w.lastCtx = nil
+	w.mtx.Unlock()
+	c, ok := w.Writer.(io.Closer)
+	if ok {
+		err_ := c.Close()
+		if err == nil {
+			err = err_
+		}
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type recordingWriter struct {
+	records []string
+	ctxs    []interface{}
+}
+
+func (w *recordingWriter) WriteWithCtx(b []byte, ctx interface{}) (int, error) {
+	w.records = append(w.records, string(b))
+	w.ctxs = append(w.ctxs, ctx)
+	return len(b), nil
+}
+
+func TestRecordWriter(t *testing.T) {
+	rw := &recordingWriter{}
+	w := NewRecordWriter(rw, nil)
+	w.MaxRecordSize = 8
+	w.WriteWithCtx([]byte("aa"), 1)
+	w.WriteWithCtx([]byte("a\nbb"), 2)
+	w.WriteWithCtx([]byte("b\nc\nd"), 3)
+	if w.Buffered() != 1 {
+		t.Logf("%d", w.Buffered())
+		t.Fail()
+	}
+	w.WriteWithCtx([]byte("ddddddddd"), 4)
+	w.WriteWithCtx([]byte("ee"), 5)
+	w.Close()
+	expected := []string{"aaa\n", "bbb\n", "c\n", "dddddddddd", "ee"}
+	expectedCtxs := []interface{}{2, 3, 3, 4, 5}
+	if len(rw.records) != len(expected) {
+		t.Logf("%q", rw.records)
+		t.FailNow()
+	}
+	for i, record := range rw.records {
+		if record != expected[i] || rw.ctxs[i] != expectedCtxs[i] {
+			t.Logf("%d: %q %v", i, record, rw.ctxs[i])
+			t.Fail()
+		}
+	}
+}
+
+func TestRecordWriterSizeBasedRotation(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	w := NewRecordWriter(NewSizeBasedRotatingWriter(
+		10,
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		SerialRotationCallbackFactory(3),
+		nil,
+	), nil)
+	for _, piece := range []string{"aaa", "aa\n", "bb", "bbb", "\nc", "c\n"} {
+		n, err := w.Write([]byte(piece))
+		if n != len(piece) || err != nil {
+			t.Logf("%d %v", n, err)
+			t.Fail()
+		}
+	}
+	w.Close()
+	expected := map[string][]byte{
+		headPath:        []byte("bbbbb\ncc\n"),
+		headPath + ".0": []byte("aaaaa\n"),
+	}
+	for path, content := range expected {
+		b, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Logf("%s: %q %v", path, b, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SiblingMatcher is supposed to tell if the file specified by path is one of the files rotated out
+// of headPath.
+type SiblingMatcher func(headPath, path string) bool
+
+// RetentionPolicy removes the oldest files rotated out of a head path until all the limits are met.
+// Each of MaxAge, MaxCount and MaxTotalBytes is ignored when it is zero.  The files are looked up by
+// Glob ("<head path>.*" if empty), then filtered by Matcher unless it is nil.  The head file itself is
+// never removed nor taken into account.  When DryRun is true, nothing gets removed actually.
+// Reporter, if not nil, is called for every file that is removed (or would be removed).
+type RetentionPolicy struct {
+	MaxAge        time.Duration
+	MaxCount      int
+	MaxTotalBytes int64
+	Glob          string
+	Matcher       SiblingMatcher
+	DryRun        bool
+	Clock         Clock
+	Reporter      func(path string, fi os.FileInfo)
+	ErrorHandler  ErrorHandler
+}
+
+type fileInfoWithPath struct {
+	path string
+	fi   os.FileInfo
+}
+
+type byModTimeDesc []fileInfoWithPath
+
+func (s byModTimeDesc) Len() int      { return len(s) }
+func (s byModTimeDesc) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byModTimeDesc) Less(i, j int) bool {
+	ti, tj := s[i].fi.ModTime(), s[j].fi.ModTime()
+	if ti.Equal(tj) {
+		// a smaller serial number means a newer file.
+		ni, iok := serialNumber(s[i].path)
+		nj, jok := serialNumber(s[j].path)
+		if iok && jok && ni != nj {
+			return ni < nj
+		}
+		return s[i].path < s[j].path
+	}
+	return ti.After(tj)
+}
+
+// Returns the serial number the path is suffixed with by SerialRenamer, if any.
+func serialNumber(path string) (uint64, bool) {
+	path = trimRotatedFileSuffix(path)
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(path[i+1:], 10, 64)
+	return n, err == nil
+}
+
+func escapeGlob(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "*", "\\*", "?", "\\?", "[", "\\[")
+	return r.Replace(s)
+}
+
+// Returns the files that have been rotated out of headPath, newest first.
+func (p *RetentionPolicy) siblings(headPath string) ([]fileInfoWithPath, error) {
+	return findSiblings(headPath, p.Glob, p.Matcher)
+}
+
+// Looks up the files rotated out of headPath by pattern ("<head path>.*" if empty), filters them by
+// matcher unless it is nil, and returns them newest first.
+func findSiblings(headPath, pattern string, matcher SiblingMatcher) ([]fileInfoWithPath, error) {
+	if pattern == "" {
+		pattern = escapeGlob(headPath) + ".*"
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	retval := make([]fileInfoWithPath, 0, len(paths))
+	for _, path := range paths {
+		if path == headPath || (matcher != nil && !matcher(headPath, path)) {
+			continue
+		}
+		fi, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		retval = append(retval, fileInfoWithPath{path, fi})
+	}
+	sort.Sort(byModTimeDesc(retval))
+	return retval, nil
+}
+
+// Applies the policy to the files rotated out of headPath, and returns the paths to the removed
+// files (or those that would be removed in dry-run mode), oldest first.
+func (p *RetentionPolicy) Apply(headPath string) ([]string, error) {
+	files, err := p.siblings(headPath)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock()
+	}
+	i := 0
+	total := int64(0)
+	for ; i < len(files); i++ {
+		fi := files[i].fi
+		total += fi.Size()
+		if (p.MaxCount > 0 && i >= p.MaxCount) || (p.MaxTotalBytes > 0 && total > p.MaxTotalBytes) || (p.MaxAge > 0 && now.Sub(fi.ModTime()) > p.MaxAge) {
+			break
+		}
+	}
+	removed := make([]string, 0, len(files)-i)
+	var firstErr error
+	for j := len(files) - 1; j >= i; j-- {
+		if !p.DryRun {
+			err := os.Remove(files[j].path)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+		if p.Reporter != nil {
+			p.Reporter(files[j].path, files[j].fi)
+		}
+		removed = append(removed, files[j].path)
+	}
+	return removed, firstErr
+}
+
+// Applies the policy, and adds the error that occurs to err, which has been returned by the callback
+// called before, so that it is reported after the writer releases its lock.
+func (p *RetentionPolicy) apply(headPath string, err error) error {
+	_, err_ := p.Apply(headPath)
+	if err_ != nil {
+		return deferError(err, p.ErrorHandler, ErrorOnRetention, headPath, err_)
+	}
+	return err
+}
+
+// Returns a RotationCallback that applies the policy after calling next.  next can be nil.  Errors that
+// occur during applying the policy don't fail the rotation; they are reported to ErrorHandler
+// with ErrorOnRetention instead, through DeferredErrors.
+func (p *RetentionPolicy) RotationCallback(next RotationCallback) RotationCallback {
+	return func(ID, path string, ctx interface{}) error {
+		var err error
+		if next != nil {
+			err = next(ID, path, ctx)
+			if fatal, _ := splitDeferredErrors(err); fatal != nil {
+				return err
+			}
+		}
+		return p.apply(path, err)
+	}
+}
+
+// Returns a Renamer that applies the policy after calling next.  Errors that occur during applying the
+// policy are treated in the same way as RotationCallback().
+func (p *RetentionPolicy) Renamer(next Renamer) Renamer {
+	return func(ID, path, src string, ctx interface{}) (string, error) {
+		newPath, err := next(ID, path, src, ctx)
+		if fatal, _ := splitDeferredErrors(err); fatal != nil {
+			return "", err
+		}
+		return newPath, p.apply(path, err)
+	}
+}
+
+// SerialSiblingMatcher is a SiblingMatcher that only accepts the files named by SerialRenamer,
+// that is, the head path suffixed by a serial number, optionally followed by the extension of
+// the compression format.
+func SerialSiblingMatcher(headPath, path string) bool {
+	if !strings.HasPrefix(path, headPath+".") {
+		return false
+	}
+	rest := trimRotatedFileSuffix(path[len(headPath)+1:])
+	_, err := strconv.ParseUint(rest, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func prepareRotatedFiles(t *testing.T, headPath string, now time.Time) {
+	for i := 0; i < 5; i++ {
+		path := headPath + "." + strconv.Itoa(i)
+		err := ioutil.WriteFile(path, []byte("0123456789"), os.FileMode(0666))
+		if err != nil {
+			t.Logf("%v", err)
+			t.FailNow()
+		}
+		mtime := now.Add(-time.Duration(i+1) * time.Hour)
+		os.Chtimes(path, mtime, mtime)
+	}
+	ioutil.WriteFile(headPath, []byte("head"), os.FileMode(0666))
+	ioutil.WriteFile(headPath+".x", []byte("other"), os.FileMode(0666))
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	now := time.Now()
+	prepareRotatedFiles(t, headPath, now)
+	p := &RetentionPolicy{
+		MaxCount: 4,
+		Matcher:  SerialSiblingMatcher,
+		DryRun:   true,
+		Clock:    func() time.Time { return now },
+	}
+	removed, err := p.Apply(headPath)
+	if err != nil || len(removed) != 1 || removed[0] != headPath+".4" {
+		t.Logf("%v %v", removed, err)
+		t.Fail()
+	}
+	if _, err := os.Stat(headPath + ".4"); err != nil {
+		t.Logf("dry run removed the file: %v", err)
+		t.Fail()
+	}
+	p.MaxTotalBytes = 30
+	p.MaxAge = 90 * time.Minute
+	removed, err = p.Apply(headPath)
+	if err != nil || len(removed) != 4 || removed[3] != headPath+".1" {
+		t.Logf("%v %v", removed, err)
+		t.Fail()
+	}
+	p.MaxAge = 0
+	p.DryRun = false
+	removed, err = p.Apply(headPath)
+	if err != nil || len(removed) != 2 {
+		t.Logf("%v %v", removed, err)
+		t.Fail()
+	}
+	names, _ := filepath.Glob(headPath + "*")
+	if len(names) != 5 {
+		t.Logf("%v", names)
+		t.Fail()
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"os"
+)
+
+// RotatedSetReader reads the files rotated out of a head path, followed by the head file itself, as
+// a single stream, oldest first.  The compressed files are decompressed on the fly.  The files are
+// looked up on creation in the same way as RetentionPolicy does, and ordered by their modification
+// time.
+//
+// Each Read() returns the data from a single file, so that Name() and Offset() tell which file the
+// data that has just been read came from.
+type RotatedSetReader struct {
+	HeadPath string
+	files    []string
+	i        int
+	name     string
+	offset   int64
+	file     *os.File
+	reader   io.Reader
+	closer   io.Closer
+}
+
+// Creates a new RotatedSetReader.  glob is used to look up the rotated files ("<head path>.*" if
+// empty) and the files are filtered by matcher unless it is nil.
+func NewRotatedSetReader(headPath, glob string, matcher SiblingMatcher) (*RotatedSetReader, error) {
+	siblings, err := findSiblings(headPath, glob, matcher)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(siblings)+1)
+	for i := len(siblings) - 1; i >= 0; i-- {
+		files = append(files, siblings[i].path)
+	}
+	_, err = os.Stat(headPath)
+	if err == nil {
+		files = append(files, headPath)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &RotatedSetReader{
+		HeadPath: headPath,
+		files:    files,
+		i:        0,
+	}, nil
+}
+
+// Returns the paths to the files to be read, oldest first.
+func (r *RotatedSetReader) Files() []string {
+	return append([]string(nil), r.files...)
+}
+
+// Name() method of Named interface.  Returns the path to the file the data most recently read came
+// from.
+func (r *RotatedSetReader) Name() string {
+	return r.name
+}
+
+// Returns the offset in the (decompressed) content of the file named by Name() right after the data
+// most recently read.
+func (r *RotatedSetReader) Offset() int64 {
+	return r.offset
+}
+
+func (r *RotatedSetReader) openNext() error {
+	path := r.files[r.i]
+	r.i += 1
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.reader = f
+	r.closer = nil
+	c, ok := compressionOf(path)
+	if ok {
+		rc, err := c.newReader(f)
+		if err != nil {
+			r.closeCurrent()
+			return err
+		}
+		r.reader = rc
+		r.closer = rc
+	}
+	r.name = path
+	r.offset = 0
+	return nil
+}
+
+func (r *RotatedSetReader) closeCurrent() error {
+	var err error
+	if r.closer != nil {
+		err = r.closer.Close()
+		r.closer = nil
+	}
+	if r.file != nil {
+		err_ := r.file.Close()
+		if err == nil {
+			err = err_
+		}
+		r.file = nil
+	}
+	r.reader = nil
+	return err
+}
+
+// Read() method of io.Reader interface.  This returns io.EOF after the end of the head file.
+func (r *RotatedSetReader) Read(b []byte) (int, error) {
+	for {
+		if r.reader == nil {
+			if r.i >= len(r.files) {
+				return 0, io.EOF
+			}
+			err := r.openNext()
+			if err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.reader.Read(b)
+		r.offset += int64(n)
+		if err == io.EOF {
+			err = r.closeCurrent()
+			if n == 0 && err == nil {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+// Closes the file being read.
+func (r *RotatedSetReader) Close() error {
+	r.i = len(r.files)
+	return r.closeCurrent()
+}
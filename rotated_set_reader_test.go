@@ -0,0 +1,104 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRotatedSetReader(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	c := NewCompressor(SerialRenamer(5), GzipCompression, nil)
+	count := 0
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		c.RotationCallback,
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	c.Wait()
+	// a file with a timestamp suffix newer than the others
+	err = ioutil.WriteFile(headPath+"."+DefaultTimestampLayout, []byte("ccc\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(headPath+"."+DefaultTimestampLayout, future, future)
+	w.Write([]byte("ddd\n"))
+	w.Close()
+	c.Wait()
+
+	r, err := NewRotatedSetReader(headPath, "", nil)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	expected := []struct {
+		name   string
+		data   string
+		offset int64
+	}{
+		{headPath + ".1.gz", "aa", 2},
+		{headPath + ".1.gz", "a\n", 4},
+		{headPath + ".0.gz", "bb", 2},
+		{headPath + ".0.gz", "b\n", 4},
+		{headPath + "." + DefaultTimestampLayout, "cc", 2},
+		{headPath + "." + DefaultTimestampLayout, "c\n", 4},
+		{headPath, "dd", 2},
+		{headPath, "d\n", 4},
+	}
+	t.Logf("%v", r.Files())
+	b := make([]byte, 2)
+	for _, e := range expected {
+		n, err := io.ReadFull(r, b)
+		if err != nil || string(b[:n]) != e.data || r.Name() != e.name || r.Offset() != e.offset {
+			t.Logf("%q %s %d %v", b[:n], r.Name(), r.Offset(), err)
+			t.Fail()
+		}
+	}
+	n, err := r.Read(b)
+	if n != 0 || err != io.EOF {
+		t.Logf("%d %v", n, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// RecoveryAction describes a step of the interrupted rotation that Recover() has completed.  NewPath
+// is empty if Path has been removed.
+type RecoveryAction struct {
+	Path    string
+	NewPath string
+}
+
+func (a RecoveryAction) String() string {
+	if a.NewPath == "" {
+		return "removed " + a.Path
+	}
+	return "renamed " + a.Path + " to " + a.NewPath
+}
+
+// Returns the path to the journal file of the rotation of the head file.
+func journalPath(headPath string) string {
+	return filepath.Join(filepath.Dir(headPath), "."+filepath.Base(headPath)+".rotation")
+}
+
+// Completes the rotation of the head file that has been interrupted, if any, and returns what has
+// been done.  This should be called before the head file is opened, typically on startup.
+func (r SerialRotation) Recover(headPath string) ([]RecoveryAction, error) {
+	return r.recover(headPath, true)
+}
+
+// The journal consists of the planned steps encoded in JSON on the first line, followed by the
+// indices of the steps that have been completed, one per line.  The paths in the steps are relative
+// to the directory containing the journal.
+func (r SerialRotation) executeJournaled(headPath string, steps []renameStep) error {
+	path := journalPath(headPath)
+	relSteps := make([]renameStep, len(steps))
+	for i, step := range steps {
+		relSteps[i] = renameStep{From: filepath.Base(step.From)}
+		if step.To != "" {
+			relSteps[i].To = filepath.Base(step.To)
+		}
+	}
+	b, err := json.Marshal(relSteps)
+	if err != nil {
+		return err
+	}
+	// the journal shows up only after it has been written as a whole.
+	tmpPath := path + ".tmp"
+	err = r.writeJournal(tmpPath, append(b, '\n'))
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err == nil && r.Durable {
+		err = syncDir(path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for i, step := range steps {
+		err = step.execute(r.Durable)
+		if err != nil {
+			// the journal is left so that the rest is done on the next rotation.
+			return err
+		}
+		notifyRenamed(headPath, step)
+		_, err = fmt.Fprintf(f, "%d\n", i)
+		if err == nil && r.Durable {
+			err = f.Sync()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (r SerialRotation) writeJournal(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0666))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err == nil && r.Durable {
+		err = f.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Reads the journal and returns the steps along with the number of the steps that have been
+// completed.
+func readJournal(path string) ([]renameStep, int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	if !scanner.Scan() {
+		return nil, 0, fmt.Errorf("%s: empty rotation journal", path)
+	}
+	steps := []renameStep(nil)
+	err = json.Unmarshal(scanner.Bytes(), &steps)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	for i, step := range steps {
+		steps[i].From = filepath.Join(dir, step.From)
+		if step.To != "" {
+			steps[i].To = filepath.Join(dir, step.To)
+		}
+	}
+	done := 0
+	for scanner.Scan() {
+		i, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			// the last line may have been written partially.
+			break
+		}
+		if i+1 > done {
+			done = i + 1
+		}
+	}
+	return steps, done, nil
+}
+
+// Completes the interrupted rotation.  The head file is renamed only if includeHead is true, as it
+// would otherwise be the file opened after the interruption.
+func (r SerialRotation) recover(headPath string, includeHead bool) ([]RecoveryAction, error) {
+	path := journalPath(headPath)
+	actions := []RecoveryAction(nil)
+	tmpPath := path + ".tmp"
+	_, err := os.Lstat(tmpPath)
+	if err == nil {
+		// no step has been taken before the journal is complete.
+		err = os.Remove(tmpPath)
+		if err != nil {
+			return actions, err
+		}
+		actions = append(actions, RecoveryAction{Path: tmpPath})
+	}
+	steps, done, err := readJournal(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return actions, nil
+		}
+		return actions, err
+	}
+	stepHeadPath := filepath.Join(filepath.Dir(path), filepath.Base(headPath))
+	for _, step := range steps[done:] {
+		if step.From == stepHeadPath && !includeHead {
+			continue
+		}
+		// the step whose completion has not been recorded may have been taken.
+		_, err = os.Lstat(step.From)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return actions, err
+		}
+		err = step.execute(r.Durable)
+		if err != nil {
+			return actions, err
+		}
+		notifyRenamed(headPath, step)
+		actions = append(actions, RecoveryAction{Path: step.From, NewPath: step.To})
+	}
+	err = os.Remove(path)
+	if err == nil && r.Durable {
+		err = syncDir(path)
+	}
+	return actions, err
+}
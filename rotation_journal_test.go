@@ -0,0 +1,144 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Leaves the files as if the process had died right after the first two steps of the rotation,
+// without recording the completion of the second one.
+func setUpInterruptedRotation(t *testing.T, headPath string) {
+	for path, content := range map[string]string{
+		headPath:        "ccc\n",
+		headPath + ".0": "bbb\n",
+		headPath + ".1": "aaa\n",
+	} {
+		err := ioutil.WriteFile(path, []byte(content), os.FileMode(0666))
+		if err != nil {
+			t.Logf("%v", err)
+			t.FailNow()
+		}
+	}
+	_, steps, err := planSerialRotation(headPath, headPath, 3)
+	if err != nil || len(steps) != 3 {
+		t.Logf("%v %v", steps, err)
+		t.FailNow()
+	}
+	journal := `[{"from":"TEST.1","to":"TEST.2"},{"from":"TEST.0","to":"TEST.1"},{"from":"TEST","to":"TEST.0"}]` + "\n0\n"
+	err = ioutil.WriteFile(journalPath(headPath), []byte(journal), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	for _, step := range steps[:2] {
+		err = step.execute(false)
+		if err != nil {
+			t.Logf("%v", err)
+			t.FailNow()
+		}
+	}
+}
+
+func checkFiles(t *testing.T, expected map[string][]byte) {
+	for path, content := range expected {
+		b, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Logf("%s: %q %v", path, b, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestSerialRotationRecover(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	setUpInterruptedRotation(t, headPath)
+	actions, err := SerialRotation{MaxFiles: 3, Durable: false, Journal: true}.Recover(headPath)
+	if err != nil || len(actions) != 1 || actions[0] != (RecoveryAction{headPath, headPath + ".0"}) {
+		t.Logf("%v %v", actions, err)
+		t.Fail()
+	}
+	checkFiles(t, map[string][]byte{
+		headPath + ".0": []byte("ccc\n"),
+		headPath + ".1": []byte("bbb\n"),
+		headPath + ".2": []byte("aaa\n"),
+	})
+	if _, err := os.Stat(journalPath(headPath)); !os.IsNotExist(err) {
+		t.Logf("the journal is left: %v", err)
+		t.Fail()
+	}
+}
+
+func TestJournaledSerialRenamer(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	setUpInterruptedRotation(t, headPath)
+	// the head file has been written again after the crash.
+	err = ioutil.WriteFile(headPath, []byte("ccc\nddd\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	newPath, err := JournaledSerialRenamer(3)("", headPath, headPath, nil)
+	if err != nil || newPath != headPath+".0" {
+		t.Logf("%s %v", newPath, err)
+		t.Fail()
+	}
+	checkFiles(t, map[string][]byte{
+		headPath + ".0": []byte("ccc\nddd\n"),
+		headPath + ".1": []byte("bbb\n"),
+		headPath + ".2": []byte("aaa\n"),
+	})
+	err = ioutil.WriteFile(headPath, []byte("eee\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	_, err = JournaledSerialRenamer(3)("", headPath, headPath, nil)
+	if err != nil {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	checkFiles(t, map[string][]byte{
+		headPath + ".0": []byte("eee\n"),
+		headPath + ".1": []byte("ccc\nddd\n"),
+		headPath + ".2": []byte("bbb\n"),
+	})
+	if _, err := os.Stat(journalPath(headPath)); !os.IsNotExist(err) {
+		t.Logf("the journal is left: %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+var stagingSeq int64
+
+// Returns a hidden path beside the head file to which the rotated file is moved aside.
+func stagingPath(path string) string {
+	seq := atomic.AddInt64(&stagingSeq, 1)
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d.%d.rotating", filepath.Base(path), os.Getpid(), seq))
+}
+
+type rotationJob struct {
+	ID   string
+	path string
+	src  string
+	ctx  interface{}
+}
+
+// RotationQueue runs Renamer in background so that a slow rename or compression doesn't stall the
+// writes.  The rotated file is moved aside to a hidden path in the same directory right away, so that
+// the head path is available for the new file, and then Renamer is called with the hidden path as src
+// by one of at most Concurrency workers, or an unlimited number of them if Concurrency is not
+// positive.  The files rotated out of the same head path are passed to Renamer one by one in the
+// order they are rotated.
+//
+// Errors returned by Renamer are reported to ErrorHandler with ErrorOnRotation, in which case the
+// file is left at the hidden path.  ctx given to RotationCallback() is retained until Renamer is
+// called with it.
+type RotationQueue struct {
+	Renamer      Renamer
+	Concurrency  int
+	ErrorHandler ErrorHandler
+	mtx          sync.Mutex
+	queues       map[string][]rotationJob
+	sem          chan struct{}
+	wg           sync.WaitGroup
+}
+
+// Creates a new RotationQueue.  errorHandler can be nil.
+func NewRotationQueue(renamer Renamer, concurrency int, errorHandler ErrorHandler) *RotationQueue {
+	return &RotationQueue{
+		Renamer:      renamer,
+		Concurrency:  concurrency,
+		ErrorHandler: errorHandler,
+		mtx:          sync.Mutex{},
+		queues:       make(map[string][]rotationJob),
+		sem:          nil,
+	}
+}
+
+// RotationCallback() has the same signature as RotationCallback.  This moves the file aside and then
+// queues it for Renamer.  Only the error that occurs during the former is returned.
+func (q *RotationQueue) RotationCallback(ID, path string, ctx interface{}) error {
+	src := stagingPath(path)
+	err := os.Rename(path, src)
+	if err != nil {
+		return err
+	}
+	q.enqueue(rotationJob{ID: ID, path: path, src: src, ctx: ctx})
+	return nil
+}
+
+func (q *RotationQueue) enqueue(job rotationJob) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.queues == nil {
+		q.queues = make(map[string][]rotationJob)
+	}
+	if q.sem == nil && q.Concurrency > 0 {
+		q.sem = make(chan struct{}, q.Concurrency)
+	}
+	jobs, running := q.queues[job.path]
+	q.queues[job.path] = append(jobs, job)
+	if !running {
+		// a worker per head path keeps the order.
+		q.wg.Add(1)
+		go q.run(job.path)
+	}
+}
+
+func (q *RotationQueue) run(path string) {
+	defer q.wg.Done()
+	for {
+		q.mtx.Lock()
+		jobs := q.queues[path]
+		if len(jobs) == 0 {
+			delete(q.queues, path)
+			q.mtx.Unlock()
+			return
+		}
+		job := jobs[0]
+		q.queues[path] = jobs[1:]
+		sem := q.sem
+		q.mtx.Unlock()
+		if sem != nil {
+			sem <- struct{}{}
+		}
+		_, err := q.Renamer(job.ID, job.path, job.src, job.ctx)
+		if sem != nil {
+			<-sem
+		}
+		// not under any lock of the writer here.
+		err = reportDeferredErrors(err)
+		if err != nil {
+			handleError(q.ErrorHandler, ErrorOnRotation, job.src, err)
+		}
+	}
+}
+
+// Waits for all the queued files to be passed to Renamer.
+func (q *RotationQueue) Wait() {
+	q.wg.Wait()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRotationQueue(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	gate := make(chan struct{})
+	renamer := SerialRenamer(10)
+	count := 0
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		nil,
+		nil,
+	)
+	w.RotationQueue = NewRotationQueue(func(ID, path, src string, ctx interface{}) (string, error) {
+		<-gate
+		return renamer(ID, path, src, ctx)
+	}, 1, nil)
+	// the writes must not wait for the renames.
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	b, err := ioutil.ReadFile(headPath)
+	if err != nil || string(b) != "ccc\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+	close(gate)
+	w.Close()
+	checkFiles(t, map[string][]byte{
+		headPath:        []byte("ccc\n"),
+		headPath + ".0": []byte("bbb\n"),
+		headPath + ".1": []byte("aaa\n"),
+	})
+	entries, err := ioutil.ReadDir(baseDir)
+	if err != nil || len(entries) != 3 {
+		t.Logf("%d %v", len(entries), err)
+		t.Fail()
+	}
+}
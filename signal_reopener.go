@@ -0,0 +1,94 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// SignalReopener calls Reopen() of the Reopener every time the process receives any of the signals,
+// so that the files moved by an external program like logrotate (with "postrotate kill -HUP") are
+// reopened.  It stops by itself once the Reopener gets closed if it implements DoneNotifier, as
+// DynamicRotatingWriter and StaticRotatingWriter do, or once Reopen() returns io.EOF.
+type SignalReopener struct {
+	Reopener     Reopener
+	ErrorHandler ErrorHandler
+	sigChan      chan os.Signal
+	done         chan struct{}
+	stopped      chan struct{}
+	closeOnce    sync.Once
+}
+
+// Subscribes r to the notifications of the signals, which defaults to SIGHUP (os.Interrupt on the
+// platforms that don't have it) if none is given.
+// errorHandler will receive errors returned by Reopen() with ErrorOnReopen.  errorHandler can be nil.
+func NotifyReopen(r Reopener, errorHandler ErrorHandler, signals ...os.Signal) *SignalReopener {
+	if len(signals) == 0 {
+		signals = defaultReopenSignals
+	}
+	s := &SignalReopener{
+		Reopener:     r,
+		ErrorHandler: errorHandler,
+		sigChan:      make(chan os.Signal, 1),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	signal.Notify(s.sigChan, signals...)
+	go s.run()
+	return s
+}
+
+func (s *SignalReopener) run() {
+	defer close(s.stopped)
+	defer signal.Stop(s.sigChan)
+	var closed <-chan struct{}
+	if dn, ok := s.Reopener.(DoneNotifier); ok {
+		closed = dn.Done()
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-closed:
+			return
+		case <-s.sigChan:
+			err := s.Reopener.Reopen()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				handleError(s.ErrorHandler, ErrorOnReopen, "", err)
+			}
+		}
+	}
+}
+
+// Unsubscribes from the notifications.  This waits for the ongoing Reopen() to complete.
+func (s *SignalReopener) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSignalReopenerStopsOnWriterClose(t *testing.T) {
+	w := &StaticRotatingWriter{
+		PathBuilder: func(_ interface{}) (string, error) {
+			return "", nil
+		},
+		WriterFactory: func(_ string, _ interface{}) (io.Writer, error) {
+			return nil, io.EOF
+		},
+	}
+	s := NotifyReopen(w, nil)
+	defer s.Close()
+	// no signal is needed to notice the writer is closed.
+	w.Close()
+	select {
+	case <-s.stopped:
+	case <-time.After(5 * time.Second):
+		t.Logf("not stopped")
+		t.Fail()
+	}
+}
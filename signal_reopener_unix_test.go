@@ -0,0 +1,72 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package ioextras
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type dummyReopener struct {
+	reopened chan struct{}
+	closed   int32
+}
+
+func (r *dummyReopener) Reopen() error {
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return io.EOF
+	}
+	r.reopened <- struct{}{}
+	return nil
+}
+
+func TestSignalReopener(t *testing.T) {
+	r := &dummyReopener{make(chan struct{}, 1), 0}
+	s := NotifyReopen(r, nil, syscall.SIGHUP)
+	defer s.Close()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	p.Signal(syscall.SIGHUP)
+	select {
+	case <-r.reopened:
+	case <-time.After(5 * time.Second):
+		t.Logf("not reopened")
+		t.FailNow()
+	}
+	atomic.StoreInt32(&r.closed, 1)
+	p.Signal(syscall.SIGHUP)
+	select {
+	case <-s.stopped:
+	case <-time.After(5 * time.Second):
+		t.Logf("not stopped")
+		t.Fail()
+	}
+}
@@ -21,10 +21,12 @@
 package ioextras
 
 import (
+	"container/list"
 	"io"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // PathBuilder is supposed to return the path to the file to write the data to.
@@ -44,21 +46,57 @@ type CloserErrorPair struct {
 }
 
 type writerEntry struct {
-	path                 string
-	w                    io.Writer
-	refs                 int64
-	closeErrorReportChan chan<- CloserErrorPair
+	path string
+	w    io.Writer
+	refs int64
+	elem *list.Element
 }
 
 // StaticRotatingWriter is an io.Writer that writes the data to the file whose path is determined
 // by the given PathBuilder.  It can be used in combination with the standard log package to
 // support logging to rotating files.
+//
+// By default, only the file for the latest path is kept open.  In partitioned mode, which is enabled
+// by setting Partitioned to true, the files for different paths are kept open at the same time, so
+// that writes interleaved across them don't cause the files to be closed and reopened over and over.
+// If MaxOpen is positive, the least recently used files that are not being written are closed when
+// the number of open files reaches it.  Such files are opened by WriterFactory again on the next
+// write to them, thus WriterFactory should open them in append mode as StandardWriterFactory does.
 type StaticRotatingWriter struct {
-	PathBuilder          PathBuilder
-	WriterFactory        WriterFactory
+	PathBuilder   PathBuilder
+	WriterFactory WriterFactory
+	Partitioned   bool
+	MaxOpen       int
+	// Buffers the data written to each file by BufferSize bytes when it is positive.  The buffers
+	// are flushed when they get full, every FlushInterval if that is positive too, before the files
+	// are closed, and on Flush() and Close().
+	BufferSize    int
+	FlushInterval time.Duration
+	// Controls when the data is committed to the storage.  See DurabilityPolicy.
+	Durability DurabilityPolicy
+	// Called right after a file is opened and right before it is closed respectively, so that a
+	// header and a footer can be written.  OnOpen is not called for a file that already has some
+	// content.  An error from OnOpen is returned from WriteWithCtx().
+	OnOpen  FileHook
+	OnClose FileHook
+	// Keeps the symbolic link at SymlinkPath pointing to the file most recently opened if it is
+	// non-empty.  The link is replaced atomically.
+	SymlinkPath string
+	// Receives the errors that occur during closing files.  CloseErrorReportChan is only used
+	// when ErrorHandler is nil, and is kept for compatibility.  The errors that the channel is not
+	// ready to receive are logged and dropped, thus it should be buffered.
+	ErrorHandler         ErrorHandler
 	CloseErrorReportChan chan<- CloserErrorPair
 	writersMtx           sync.Mutex
 	writers              map[string]*writerEntry
+	lru                  list.List
+	reporting            sync.WaitGroup
+	flusher              *periodicTask
+	syncTask             *periodicTask
+	lastPath             string
+	stats                statsRecorder
+	closed               bool
+	done                 chan struct{}
 }
 
 func (w *writerEntry) addRef() {
@@ -68,15 +106,6 @@ func (w *writerEntry) addRef() {
 func (w *writerEntry) delRef() bool {
 	refs := atomic.AddInt64(&w.refs, -1)
 	if refs == 0 {
-		c, ok := w.w.(io.Closer)
-		if ok {
-			err := c.Close()
-			if err != nil {
-				if w.closeErrorReportChan != nil {
-					w.closeErrorReportChan <- CloserErrorPair{c, err}
-				}
-			}
-		}
 		return true
 	} else if refs < 0 {
 		panic("something went wrong!")
@@ -97,83 +126,302 @@ func (w *StaticRotatingWriter) WriteWithCtx(b []byte, ctx interface{}) (int, err
 	if err != nil {
 		return 0, err
 	}
+	writersToBeClosed := []*writerEntry(nil)
+	var symlinkErr error
 	we, err := func(path string) (*writerEntry, error) {
 		w.writersMtx.Lock()
 		defer w.writersMtx.Unlock()
+		if w.closed {
+			return nil, io.EOF
+		}
+		if w.writers == nil {
+			w.writers = make(map[string]*writerEntry)
+		}
+		w.lastPath = path
 		we, ok := w.writers[path]
 		if !ok {
-			writersToBeRemoved := make([]*writerEntry, 0, len(w.writers))
-			for _, we_ := range w.writers {
-				if we_.delRef() {
-					writersToBeRemoved = append(writersToBeRemoved, we_)
+			if w.Partitioned {
+				writersToBeClosed = w.evict()
+				for range writersToBeClosed {
+					w.stats.recordRotation(0)
+				}
+			} else {
+				// the file being written is always closed for another.
+				if len(w.writers) > 0 {
+					w.stats.recordRotation(0)
+				}
+				for _, we_ := range w.writers {
+					if we_.delRef() {
+						writersToBeClosed = append(writersToBeClosed, we_)
+					}
+				}
+				for _, we_ := range writersToBeClosed {
+					delete(w.writers, we_.path)
 				}
-			}
-			for _, we_ := range writersToBeRemoved {
-				delete(w.writers, we_.path)
 			}
 			w_, err := w.WriterFactory(path, ctx)
 			if err != nil {
 				return nil, err
 			}
+			empty := writerFileSize(w_) == 0
+			w_, err = w.wrap(w_)
+			if err != nil {
+				return nil, err
+			}
 			we = &writerEntry{
-				path:                 path,
-				w:                    w_,
-				refs:                 1,
-				closeErrorReportChan: (chan<- CloserErrorPair)(w.CloseErrorReportChan),
+				path: path,
+				w:    w_,
+				refs: 1,
 			}
 			w.writers[path] = we
+			if w.Partitioned {
+				we.elem = w.lru.PushFront(we)
+			}
+			if w.SymlinkPath != "" {
+				symlinkErr = updateSymlink(w.SymlinkPath, path)
+			}
+			if empty && w.OnOpen != nil {
+				err := w.OnOpen(we.w, path, "", ctx)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else if we.elem != nil {
+			w.lru.MoveToFront(we.elem)
 		}
 		we.addRef()
 		return we, nil
 	}(path)
+	// the files are closed outside the lock so that a slow close doesn't block the other writes.
+	w.closeEntries(writersToBeClosed)
+	if symlinkErr != nil {
+		handleError(w.ErrorHandler, ErrorOnSymlink, w.SymlinkPath, symlinkErr)
+	}
 	if err != nil {
 		return 0, err
 	}
 	defer func() {
 		if we.delRef() {
 			w.writersMtx.Lock()
-			defer w.writersMtx.Unlock()
-			delete(w.writers, we.path)
+			w.removeEntry(we)
+			w.writersMtx.Unlock()
+			w.closeEntries([]*writerEntry{we})
 		}
 	}()
-	return we.w.Write(b)
+	n, err := we.w.Write(b)
+	w.stats.recordWrite(path, n)
+	return n, err
 }
 
-// Closes the opened files.  It needs to be made sure that this is called after all the ongoing write
-// operations have been done.  Otherwise the files may be left open.
-func (w *StaticRotatingWriter) Close() error {
+// Wraps the writer returned by WriterFactory according to Durability and BufferSize.
+func (w *StaticRotatingWriter) wrap(wr io.Writer) (io.Writer, error) {
+	wr, err := w.Durability.wrap(wr)
+	if err != nil {
+		return nil, err
+	}
+	if w.Durability.Mode == DurabilitySyncPeriodic && w.Durability.SyncInterval > 0 && w.syncTask == nil {
+		w.syncTask = startPeriodicTask(w.Durability.SyncInterval, func() {
+			err := w.Sync()
+			if err != nil {
+				handleError(w.ErrorHandler, ErrorOnSync, "", err)
+			}
+		})
+	}
+	if w.BufferSize <= 0 {
+		return wr, nil
+	}
+	if w.FlushInterval > 0 && w.flusher == nil {
+		w.flusher = startPeriodicTask(w.FlushInterval, func() {
+			err := w.Flush()
+			if err != nil {
+				handleError(w.ErrorHandler, ErrorOnFlush, "", err)
+			}
+		})
+	}
+	return newBufferedWriter(wr, w.BufferSize), nil
+}
+
+// Flush() method of Flusher interface.  Flushes the buffered data, if any, to the open files.  The
+// first error that occurs is returned.
+func (w *StaticRotatingWriter) Flush() error {
 	w.writersMtx.Lock()
 	defer w.writersMtx.Unlock()
-	writersToBeRemoved := make([]*writerEntry, 0, len(w.writers))
+	var err error
 	for _, we := range w.writers {
-		if we.delRef() {
-			writersToBeRemoved = append(writersToBeRemoved, we)
+		err_ := flushWriter(we.w)
+		if err == nil {
+			err = err_
+		}
+	}
+	return err
+}
+
+// Flushes the buffered data, if any, and commits the open files to the storage.  The first error that
+// occurs is returned.
+func (w *StaticRotatingWriter) Sync() error {
+	w.writersMtx.Lock()
+	defer w.writersMtx.Unlock()
+	var err error
+	for _, we := range w.writers {
+		err_ := syncWriter(we.w)
+		if err == nil {
+			err = err_
 		}
 	}
-	for _, we := range writersToBeRemoved {
+	return err
+}
+
+// Closes the writers of the entries that have been removed from the map, and then reports the
+// errors if any.
+func (w *StaticRotatingWriter) closeEntries(wes []*writerEntry) {
+	reports := []pendingErrorReport(nil)
+	for _, we := range wes {
+		if w.OnClose != nil {
+			err := w.OnClose(we.w, we.path, "", nil)
+			if err != nil {
+				reports = append(reports, pendingErrorReport{ErrorOnHook, we.path, nil, err, nil})
+			}
+		}
+		c, ok := we.w.(io.Closer)
+		if ok {
+			err := c.Close()
+			if err != nil {
+				reports = append(reports, pendingErrorReport{ErrorOnClose, we.path, c, err, nil})
+				w.stats.recordCloseError()
+			}
+		}
+		w.stats.forgetPath(we.path)
+	}
+	if len(reports) > 0 {
+		w.reporting.Add(1)
+		defer w.reporting.Done()
+		reportErrors(w.ErrorHandler, w.CloseErrorReportChan, reports)
+	}
+}
+
+func (w *StaticRotatingWriter) removeEntry(we *writerEntry) {
+	// the entry may have been replaced by a new one for the same path.
+	if w.writers[we.path] == we {
 		delete(w.writers, we.path)
 	}
-	close(w.CloseErrorReportChan)
+	if we.elem != nil {
+		w.lru.Remove(we.elem)
+		we.elem = nil
+	}
+}
+
+// Removes the least recently used entries that are not being written until the number of the open
+// files gets below MaxOpen, and returns them.  The entries being written are never removed, so the
+// number may stay above the limit.
+func (w *StaticRotatingWriter) evict() []*writerEntry {
+	if w.MaxOpen <= 0 {
+		return nil
+	}
+	evicted := []*writerEntry(nil)
+	for e := w.lru.Back(); e != nil && len(w.writers) >= w.MaxOpen; {
+		we := e.Value.(*writerEntry)
+		e = e.Prev()
+		// only the map holds the reference; no one can add another while the lock is held.
+		if atomic.LoadInt64(&we.refs) == 1 {
+			w.removeEntry(we)
+			we.delRef()
+			evicted = append(evicted, we)
+		}
+	}
+	return evicted
+}
+
+// Closes all the opened files so that they will be opened again on the next write to each of them.
+// The files being written at the moment are closed right after the ongoing writes complete.  This is
+// useful when the files have been moved by someone else, like logrotate.
+func (w *StaticRotatingWriter) Reopen() error {
+	w.writersMtx.Lock()
+	if w.closed {
+		w.writersMtx.Unlock()
+		return io.EOF
+	}
+	writersToBeClosed := w.releaseAll()
+	w.writersMtx.Unlock()
+	w.closeEntries(writersToBeClosed)
+	return nil
+}
+
+// Drops the references the map holds, and returns the entries that are no longer used.
+func (w *StaticRotatingWriter) releaseAll() []*writerEntry {
+	writersToBeClosed := make([]*writerEntry, 0, len(w.writers))
+	for _, we := range w.writers {
+		w.removeEntry(we)
+		if we.delRef() {
+			writersToBeClosed = append(writersToBeClosed, we)
+		}
+	}
+	return writersToBeClosed
+}
+
+// Closes the opened files.  It needs to be made sure that this is called after all the ongoing write
+// operations have been done.  Otherwise the files may be left open.
+func (w *StaticRotatingWriter) Close() error {
+	w.writersMtx.Lock()
+	if w.closed {
+		w.writersMtx.Unlock()
+		return nil
+	}
+	w.closed = true
+	writersToBeClosed := w.releaseAll()
+	if w.done != nil {
+		close(w.done)
+	}
+	tasks := []*periodicTask{w.flusher, w.syncTask}
+	w.flusher, w.syncTask = nil, nil
+	w.writersMtx.Unlock()
+	for _, task := range tasks {
+		if task != nil {
+			task.Stop()
+		}
+	}
+	w.closeEntries(writersToBeClosed)
+	if w.CloseErrorReportChan != nil {
+		w.reporting.Wait()
+		close(w.CloseErrorReportChan)
+	}
 	return nil
 }
 
+// Done() method of DoneNotifier interface.  The returned channel is closed when Close() is called.
+func (w *StaticRotatingWriter) Done() <-chan struct{} {
+	w.writersMtx.Lock()
+	defer w.writersMtx.Unlock()
+	if w.done == nil {
+		w.done = make(chan struct{})
+		if w.closed {
+			close(w.done)
+		}
+	}
+	return w.done
+}
+
+// Stats() method of StatsProvider interface.
+func (w *StaticRotatingWriter) Stats() WriterStats {
+	w.writersMtx.Lock()
+	defer w.writersMtx.Unlock()
+	stats := WriterStats{
+		CurrentPath: w.lastPath,
+		OpenFiles:   len(w.writers),
+	}
+	w.stats.snapshot(&stats)
+	return stats
+}
+
 // Creates a new StaticRotatingWriter.  Pass StandardWriterFactory as writerFactory if you aren't
 // interested in any contextual information passed as the second argument of WriteWithCtx() when
-// opening the file.  closeErrorReportChan is a channel that will asynchronously receive errors
-// that occur during closing files that have been opened bby writerFastory.  closeErrorReportChan
-// can be nil.
+// opening the file.  closeErrorReportChan is a channel that will receive errors that occur during
+// closing files that have been opened bby writerFastory, and is closed on Close().
+// closeErrorReportChan can be nil, in which case the errors are dropped unless ErrorHandler is set.
 func NewStaticRotatingWriter(pathBuilder PathBuilder, writerFactory WriterFactory, closeErrorReportChan chan<- CloserErrorPair) *StaticRotatingWriter {
-	if closeErrorReportChan == nil {
-		closeErrorReportChan_ := make(chan CloserErrorPair)
-		closeErrorReportChan = (chan<- CloserErrorPair)(closeErrorReportChan_)
-		go func() {
-			for _ = range closeErrorReportChan_ {
-			} // just ignoring errors
-		}()
-	}
 	return &StaticRotatingWriter{
 		PathBuilder:          pathBuilder,
 		WriterFactory:        writerFactory,
+		ErrorHandler:         nil,
 		CloseErrorReportChan: closeErrorReportChan,
 		writersMtx:           sync.Mutex{},
 		writers:              make(map[string]*writerEntry),
@@ -181,7 +429,8 @@ func NewStaticRotatingWriter(pathBuilder PathBuilder, writerFactory WriterFactor
 }
 
 // Just a thin wrapper of os.OpenFile, passing os.O_CREATE | os.O_WRONLY | os.O_APPEND to
-// the second argument and os.FileMode(0666) as the third argument.
+// the second argument and os.FileMode(0666) as the third argument.  Use FileWriterFactory for more
+// control over how the files are opened.
 func StandardWriterFactory(path string, _ interface{}) (io.Writer, error) {
 	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.FileMode(0666))
 }
@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"io"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -93,6 +94,76 @@ func TestStaticRotatingWriter(t *testing.T) {
 	}
 }
 
+func TestStaticRotatingWriterReopen(t *testing.T) {
+	writers := make([]*bytes.Buffer, 0)
+	results := make([][]byte, 0)
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			return "constant", nil
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			w := &bytes.Buffer{}
+			writers = append(writers, w)
+			return &IOCombo{Writer: w, Closer: &dummyCloser{&results, w, sync.Mutex{}, nil}}, nil
+		},
+		nil,
+	)
+	w.Write([]byte("aaa"))
+	w.Write([]byte("bbb"))
+	w.Reopen()
+	t.Logf("len(results)=%d", len(results))
+	if len(results) != 1 {
+		t.Fail()
+	}
+	w.Write([]byte("ccc"))
+	t.Logf("len(writers)=%d", len(writers))
+	if len(writers) != 2 {
+		t.FailNow()
+	}
+	if !bytes.Equal(writers[0].Bytes(), []byte("aaabbb")) {
+		t.Fail()
+	}
+	if !bytes.Equal(writers[1].Bytes(), []byte("ccc")) {
+		t.Fail()
+	}
+}
+
+func TestStaticRotatingWriterPartitioned(t *testing.T) {
+	paths := []string{"a", "b", "a", "b", "c", "a", "c"}
+	count := -1
+	opened := make([]string, 0)
+	results := make([][]byte, 0)
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			count += 1
+			return paths[count], nil
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			w := &bytes.Buffer{}
+			opened = append(opened, path)
+			return &IOCombo{Writer: w, Closer: &dummyCloser{&results, w, sync.Mutex{}, nil}}, nil
+		},
+		nil,
+	)
+	w.Partitioned = true
+	w.MaxOpen = 2
+	for i := range paths {
+		w.Write([]byte(strconv.Itoa(i)))
+	}
+	t.Logf("opened=%v", opened)
+	if strings.Join(opened, "") != "abca" {
+		t.Fail()
+	}
+	t.Logf("len(results)=%d", len(results))
+	if len(results) != 2 || !bytes.Equal(results[0], []byte("02")) || !bytes.Equal(results[1], []byte("13")) {
+		t.Fail()
+	}
+	w.Close()
+	if len(results) != 4 {
+		t.Fail()
+	}
+}
+
 type fancyWriter struct {
 	w             io.Writer
 	condFulfilled *bool
@@ -159,3 +230,43 @@ func TestStaticRotatingWriterConcurrent(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestStaticRotatingWriterHooks(t *testing.T) {
+	writers := make([]*bytes.Buffer, 0)
+	results := make([][]byte, 0)
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			return ctx.(string), nil
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			w := &bytes.Buffer{}
+			writers = append(writers, w)
+			return &IOCombo{Writer: w, Closer: &dummyCloser{&results, w, sync.Mutex{}, nil}}, nil
+		},
+		nil,
+	)
+	w.OnOpen = func(wr io.Writer, path, ID string, _ interface{}) error {
+		_, err := wr.Write([]byte("<" + path + ">"))
+		return err
+	}
+	w.OnClose = func(wr io.Writer, path, ID string, _ interface{}) error {
+		_, err := wr.Write([]byte("</" + path + ">"))
+		return err
+	}
+	w.WriteWithCtx([]byte("aaa"), "a")
+	w.WriteWithCtx([]byte("bbb"), "b")
+	w.WriteWithCtx([]byte("ccc"), "b")
+	w.Close()
+	t.Logf("len(writers)=%d", len(writers))
+	if len(writers) != 2 {
+		t.FailNow()
+	}
+	if writers[0].String() != "<a>aaa</a>" {
+		t.Logf("%q", writers[0].String())
+		t.Fail()
+	}
+	if writers[1].String() != "<b>bbbccc</b>" {
+		t.Logf("%q", writers[1].String())
+		t.Fail()
+	}
+}
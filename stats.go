@@ -0,0 +1,213 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PathStats holds the number of bytes and writes that have gone to a path.
+type PathStats struct {
+	Bytes  int64
+	Writes int64
+}
+
+// WriterStats is a snapshot of the statistics of a rotating writer.  Bytes and Writes are the numbers
+// of bytes and writes that have gone to all the files since the writer was created.  Paths holds the
+// statistics of the files currently open, counted since each of them was opened; the entry of a path
+// is dropped once its file is closed, so that neither the map nor the number of the "path" labels
+// written by WritePrometheusStats() grows without bound.  Rotations is the number of the files that
+// have been written and then rotated out successfully, or closed to switch to another for
+// StaticRotatingWriter, which doesn't include the files kept open in the partitioned mode until
+// they are evicted.  RotationCallbackTotal, RotationCallbackMax and
+// RotationCallbackLast tell how long RotationCallback has taken, which are always zero for
+// StaticRotatingWriter.  CurrentID is always empty for StaticRotatingWriter, and CurrentPath is the
+// path most recently written for it.
+type WriterStats struct {
+	CurrentID             string
+	CurrentPath           string
+	OpenFiles             int
+	Rotations             int64
+	CloseErrors           int64
+	Bytes                 int64
+	Writes                int64
+	RotationCallbackTotal time.Duration
+	RotationCallbackMax   time.Duration
+	RotationCallbackLast  time.Duration
+	Paths                 map[string]PathStats
+}
+
+// StatsProvider is what provides WriterStats.  DynamicRotatingWriter and StaticRotatingWriter
+// implement this.
+type StatsProvider interface {
+	Stats() WriterStats
+}
+
+// statsRecorder accumulates the statistics shared by the rotating writers.
+type statsRecorder struct {
+	mtx           sync.Mutex
+	paths         map[string]*PathStats
+	rotations     int64
+	closeErrors   int64
+	bytes         int64
+	writes        int64
+	callbackTotal time.Duration
+	callbackMax   time.Duration
+	callbackLast  time.Duration
+}
+
+func (r *statsRecorder) recordWrite(path string, n int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.paths == nil {
+		r.paths = make(map[string]*PathStats)
+	}
+	ps, ok := r.paths[path]
+	if !ok {
+		ps = &PathStats{}
+		r.paths[path] = ps
+	}
+	ps.Bytes += int64(n)
+	ps.Writes += 1
+	r.bytes += int64(n)
+	r.writes += 1
+}
+
+// Drops the statistics of the path whose file has been closed.
+func (r *statsRecorder) forgetPath(path string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.paths, path)
+}
+
+func (r *statsRecorder) recordRotation(callbackTime time.Duration) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.rotations += 1
+	r.callbackTotal += callbackTime
+	r.callbackLast = callbackTime
+	if callbackTime > r.callbackMax {
+		r.callbackMax = callbackTime
+	}
+}
+
+func (r *statsRecorder) recordCloseError() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.closeErrors += 1
+}
+
+func (r *statsRecorder) snapshot(stats *WriterStats) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	stats.Rotations = r.rotations
+	stats.CloseErrors = r.closeErrors
+	stats.Bytes = r.bytes
+	stats.Writes = r.writes
+	stats.RotationCallbackTotal = r.callbackTotal
+	stats.RotationCallbackMax = r.callbackMax
+	stats.RotationCallbackLast = r.callbackLast
+	stats.Paths = make(map[string]PathStats, len(r.paths))
+	for path, ps := range r.paths {
+		stats.Paths[path] = *ps
+	}
+}
+
+// StatsVar implements expvar.Var, so that the statistics of Provider can be published by passing it
+// to expvar.Publish().  The statistics are taken every time the variable is read.
+type StatsVar struct {
+	Provider StatsProvider
+}
+
+// Returns the statistics encoded in JSON.
+func (v StatsVar) String() string {
+	b, err := json.Marshal(v.Provider.Stats())
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+var prometheusLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type prometheusMetric struct {
+	name  string
+	typ   string
+	help  string
+	value func(stats WriterStats) float64
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{"ioextras_open_files", "gauge", "Number of files currently open.", func(stats WriterStats) float64 { return float64(stats.OpenFiles) }},
+	{"ioextras_rotations_total", "counter", "Number of rotations performed.", func(stats WriterStats) float64 { return float64(stats.Rotations) }},
+	{"ioextras_close_errors_total", "counter", "Number of errors that occurred during closing files.", func(stats WriterStats) float64 { return float64(stats.CloseErrors) }},
+	{"ioextras_written_bytes_total", "counter", "Number of bytes written.", func(stats WriterStats) float64 { return float64(stats.Bytes) }},
+	{"ioextras_writes_total", "counter", "Number of writes.", func(stats WriterStats) float64 { return float64(stats.Writes) }},
+	{"ioextras_rotation_callback_seconds_total", "counter", "Total time spent in the rotation callback.", func(stats WriterStats) float64 { return stats.RotationCallbackTotal.Seconds() }},
+	{"ioextras_rotation_callback_seconds_max", "gauge", "Longest time spent in a single call of the rotation callback.", func(stats WriterStats) float64 { return stats.RotationCallbackMax.Seconds() }},
+}
+
+// Writes the statistics in the Prometheus text exposition format, which can be served as it is at
+// the metrics endpoint.  stats maps the name of each writer, which is put in the "writer" label, to
+// its statistics.  The statistics of the files currently open are labelled with "path" as well,
+// which are gauges as they start over when the file is opened again.
+func WritePrometheusStats(w io.Writer, stats map[string]WriterStats) error {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, m := range prometheusMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s{writer=\"%s\"} %g\n", m.name, prometheusLabelValueEscaper.Replace(name), m.value(stats[name]))
+		}
+	}
+	for _, m := range []struct {
+		name  string
+		help  string
+		value func(ps PathStats) int64
+	}{
+		{"ioextras_open_file_written_bytes", "Number of bytes written to the file open at the path.", func(ps PathStats) int64 { return ps.Bytes }},
+		{"ioextras_open_file_writes", "Number of writes to the file open at the path.", func(ps PathStats) int64 { return ps.Writes }},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, name := range names {
+			paths := make([]string, 0, len(stats[name].Paths))
+			for path := range stats[name].Paths {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				fmt.Fprintf(bw, "%s{writer=\"%s\",path=\"%s\"} %d\n", m.name, prometheusLabelValueEscaper.Replace(name), prometheusLabelValueEscaper.Replace(path), m.value(stats[name].Paths[path]))
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDynamicRotatingWriterStats(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	id := "1"
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return id
+		},
+		StandardWriterFactory,
+		func(ID string, _ interface{}) string {
+			return filepath.Join(baseDir, ID)
+		},
+		func(_, _ string, _ interface{}) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	id = "2"
+	w.Write([]byte("cc\n"))
+	stats := w.Stats()
+	if stats.CurrentID != "2" || stats.CurrentPath != filepath.Join(baseDir, "2") || stats.OpenFiles != 1 || stats.Rotations != 1 {
+		t.Logf("%+v", stats)
+		t.Fail()
+	}
+	if stats.RotationCallbackTotal < time.Millisecond || stats.RotationCallbackMax != stats.RotationCallbackTotal {
+		t.Logf("%+v", stats)
+		t.Fail()
+	}
+	// the rotated file is no longer open.
+	if len(stats.Paths) != 1 || stats.Paths[filepath.Join(baseDir, "2")] != (PathStats{Bytes: 3, Writes: 1}) {
+		t.Logf("%+v", stats.Paths)
+		t.Fail()
+	}
+	w.Close()
+	if w.Stats().OpenFiles != 0 {
+		t.Fail()
+	}
+	decoded := WriterStats{}
+	err = json.Unmarshal([]byte(StatsVar{w}.String()), &decoded)
+	if err != nil || decoded.Rotations != 1 || len(decoded.Paths) != 0 {
+		t.Logf("%+v %v", decoded, err)
+		t.Fail()
+	}
+}
+
+func TestStaticRotatingWriterStats(t *testing.T) {
+	writers := make([]*bytes.Buffer, 0)
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			return ctx.(string), nil
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			w := &bytes.Buffer{}
+			writers = append(writers, w)
+			return &IOCombo{Writer: w, Closer: &failingCloser{}}, nil
+		},
+		nil,
+	)
+	w.WriteWithCtx([]byte("aaa"), "a")
+	w.WriteWithCtx([]byte("bb"), "b")
+	w.WriteWithCtx([]byte("c"), "b")
+	stats := w.Stats()
+	if stats.CurrentPath != "b" || stats.OpenFiles != 1 || stats.Rotations != 1 || stats.CloseErrors != 1 {
+		t.Logf("%+v", stats)
+		t.Fail()
+	}
+	if len(stats.Paths) != 1 || stats.Paths["b"] != (PathStats{Bytes: 3, Writes: 2}) {
+		t.Logf("%+v", stats.Paths)
+		t.Fail()
+	}
+	w.Close()
+}
+
+func TestStaticRotatingWriterStatsPartitioned(t *testing.T) {
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			return ctx.(string), nil
+		},
+		func(path string, ctx interface{}) (io.Writer, error) {
+			return &bytes.Buffer{}, nil
+		},
+		nil,
+	)
+	w.Partitioned = true
+	w.MaxOpen = 2
+	// interleaved writes to the files kept open are not rotations.
+	w.WriteWithCtx([]byte("aaa"), "a")
+	w.WriteWithCtx([]byte("bbb"), "b")
+	w.WriteWithCtx([]byte("ccc"), "a")
+	w.WriteWithCtx([]byte("ddd"), "b")
+	stats := w.Stats()
+	if stats.OpenFiles != 2 || stats.Rotations != 0 || len(stats.Paths) != 2 {
+		t.Logf("%+v", stats)
+		t.Fail()
+	}
+	// "a" is evicted for "c".
+	w.WriteWithCtx([]byte("eee"), "c")
+	stats = w.Stats()
+	if stats.OpenFiles != 2 || stats.Rotations != 1 || stats.Paths["a"] != (PathStats{}) || stats.Paths["c"] != (PathStats{Bytes: 3, Writes: 1}) {
+		t.Logf("%+v", stats)
+		t.Fail()
+	}
+	w.Close()
+}
+
+func TestWritePrometheusStats(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WritePrometheusStats(buf, map[string]WriterStats{
+		"app": {
+			OpenFiles:             1,
+			Rotations:             2,
+			RotationCallbackTotal: 1500 * time.Millisecond,
+			Bytes:                 25,
+			Writes:                7,
+			Paths:                 map[string]PathStats{`/var/log/"app".log`: {Bytes: 10, Writes: 3}},
+		},
+	})
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	for _, line := range []string{
+		"# TYPE ioextras_open_files gauge",
+		`ioextras_open_files{writer="app"} 1`,
+		`ioextras_rotations_total{writer="app"} 2`,
+		`ioextras_rotation_callback_seconds_total{writer="app"} 1.5`,
+		`ioextras_written_bytes_total{writer="app"} 25`,
+		`ioextras_writes_total{writer="app"} 7`,
+		"# TYPE ioextras_open_file_written_bytes gauge",
+		`ioextras_open_file_written_bytes{writer="app",path="/var/log/\"app\".log"} 10`,
+		`ioextras_open_file_writes{writer="app",path="/var/log/\"app\".log"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Logf("%q not found in:\n%s", line, buf.String())
+			t.Fail()
+		}
+	}
+}
+
+func TestDynamicRotatingWriterStatsFailedRotation(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	failures := 2
+	id := "1"
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return id
+		},
+		StandardWriterFactory,
+		func(ID string, _ interface{}) string {
+			return filepath.Join(baseDir, ID)
+		},
+		func(_, _ string, _ interface{}) error {
+			if failures > 0 {
+				failures -= 1
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		},
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	id = "2"
+	// the rotation is retried by every write until the callback succeeds.
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	w.Write([]byte("ddd\n"))
+	stats := w.Stats()
+	if stats.Rotations != 1 || stats.Bytes != 8 || stats.Writes != 2 {
+		t.Logf("%+v", stats)
+		t.Fail()
+	}
+	w.Close()
+}
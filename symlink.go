@@ -0,0 +1,60 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Points the symbolic link at link to target.  A temporary link is created beside link first and then
+// renamed over it, so that link never disappears even for a moment.  The link is made relative to the
+// directory it resides in where possible, so that it survives the whole tree being moved.
+func updateSymlink(link, target string) error {
+	dir := filepath.Dir(link)
+	absDir, err := filepath.Abs(dir)
+	if err == nil {
+		absTarget, err := filepath.Abs(target)
+		if err == nil {
+			rel, err := filepath.Rel(absDir, absTarget)
+			if err == nil {
+				target = rel
+			}
+		}
+	}
+	current, err := os.Readlink(link)
+	if err == nil && current == target {
+		return nil
+	}
+	tmpPath := filepath.Join(dir, "."+filepath.Base(link)+"."+strconv.Itoa(os.Getpid())+".tmp")
+	os.Remove(tmpPath)
+	err = os.Symlink(target, tmpPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, link)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSymlinkDynamicRotatingWriter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links may not be available")
+	}
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	id := "1"
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			return id
+		},
+		StandardWriterFactory,
+		func(ID string, _ interface{}) string {
+			return filepath.Join(baseDir, "app."+ID+".log")
+		},
+		nil,
+		nil,
+	)
+	w.SymlinkPath = filepath.Join(baseDir, "app.current.log")
+	defer w.Close()
+	w.Write([]byte("aaa\n"))
+	id = "2"
+	w.Write([]byte("bbb\n"))
+	target, err := os.Readlink(w.SymlinkPath)
+	if err != nil || target != "app.2.log" {
+		t.Logf("%s %v", target, err)
+		t.Fail()
+	}
+	b, err := ioutil.ReadFile(w.SymlinkPath)
+	if err != nil || string(b) != "bbb\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
+
+func TestSymlinkStaticRotatingWriter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links may not be available")
+	}
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	err = os.Mkdir(filepath.Join(baseDir, "logs"), os.FileMode(0777))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			return filepath.Join(baseDir, "logs", ctx.(string)), nil
+		},
+		StandardWriterFactory,
+		nil,
+	)
+	w.SymlinkPath = filepath.Join(baseDir, "current")
+	w.ErrorHandler = &CollectingErrorHandler{}
+	defer w.Close()
+	w.WriteWithCtx([]byte("aaa\n"), "a")
+	w.WriteWithCtx([]byte("bbb\n"), "b")
+	target, err := os.Readlink(w.SymlinkPath)
+	if err != nil || target != filepath.Join("logs", "b") {
+		t.Logf("%s %v", target, err)
+		t.Fail()
+	}
+	if len(w.ErrorHandler.(*CollectingErrorHandler).Reports()) != 0 {
+		t.Logf("%v", w.ErrorHandler.(*CollectingErrorHandler).Reports())
+		t.Fail()
+	}
+}
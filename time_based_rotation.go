@@ -0,0 +1,253 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Clock is supposed to return the current time.  time.Now is used where it is not given.
+type Clock func() time.Time
+
+const day = 24 * time.Hour
+
+// TimeBasedRotation determines the rotation cycle by the wall clock time.  Every Interval starts a new
+// cycle, and the path to the file for the cycle is given by formatting the time the cycle begins at
+// with Pattern, which may contain the following strftime(3)-style conversion specifications:
+//
+//	%Y %y %m %d %e %j %H %I %M %S %p %a %A %b %B %z %Z %s %F %T %%
+//
+// Intervals that divide a day (or are a multiple of days) are aligned to the midnight of the
+// Location, so that daylight saving time transitions don't shift the boundaries.  See CycleStart()
+// for the cycles the transitions fall in.
+type TimeBasedRotation struct {
+	Pattern  string
+	Interval time.Duration
+	Location *time.Location
+	Clock    Clock
+}
+
+// Creates a new TimeBasedRotation.  location can be nil, in which case time.Local is used.
+func NewTimeBasedRotation(pattern string, interval time.Duration, location *time.Location) *TimeBasedRotation {
+	if location == nil {
+		location = time.Local
+	}
+	return &TimeBasedRotation{
+		Pattern:  pattern,
+		Interval: interval,
+		Location: location,
+		Clock:    nil,
+	}
+}
+
+func (r *TimeBasedRotation) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
+
+func (r *TimeBasedRotation) location() *time.Location {
+	if r.Location != nil {
+		return r.Location
+	}
+	return time.Local
+}
+
+// Returns the time the cycle that t belongs to begins at.  A cycle that divides a day (or is a
+// multiple of days) begins at the first instant the wall clock reads its start, or at the instant of
+// the transition if the wall clock skips over it.  When the wall clock goes back, the cycle that has
+// begun last lasts until the wall clock gets past the start of the next one, thus the cycles never go
+// backwards.
+func (r *TimeBasedRotation) CycleStart(t time.Time) time.Time {
+	loc := r.location()
+	t = t.In(loc)
+	if r.Interval <= 0 {
+		return t
+	}
+	if r.Interval%day != 0 && day%r.Interval != 0 {
+		return t.Truncate(r.Interval)
+	}
+	y, m, d := t.Date()
+	// the wall clock represented in UTC, which never skips nor goes back.
+	wall := r.wallCycleStart(time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC))
+	start := firstInstant(wall, loc)
+	for {
+		next := firstInstant(wall.Add(r.Interval), loc)
+		if next.After(t) {
+			return start
+		}
+		wall, start = wall.Add(r.Interval), next
+	}
+}
+
+// Returns the start of the cycle on the wall clock represented in UTC.
+func (r *TimeBasedRotation) wallCycleStart(wall time.Time) time.Time {
+	if r.Interval%day == 0 {
+		// count the days in the civil calendar so that a 23- or 25-hour day doesn't matter.
+		days := int64(r.Interval / day)
+		n := floorDiv(wall.Unix(), int64(day/time.Second))
+		return time.Unix(floorDiv(n, days)*days*int64(day/time.Second), 0).UTC()
+	}
+	return wall.Truncate(r.Interval)
+}
+
+// Returns the first instant the wall clock of loc reads wall, which is represented in UTC, or the
+// instant the wall clock skips over it if it never does.  At most one transition is assumed to occur
+// within a day around wall.
+func firstInstant(wall time.Time, loc *time.Location) time.Time {
+	offsets := make([]int, 0, 3)
+	for _, d := range []time.Duration{-day, 0, day} {
+		_, offset := wall.Add(d).In(loc).Zone()
+		offsets = append(offsets, offset)
+	}
+	minOffset, maxOffset := offsets[0], offsets[0]
+	var first time.Time
+	found := false
+	for _, offset := range offsets {
+		if offset < minOffset {
+			minOffset = offset
+		}
+		if offset > maxOffset {
+			maxOffset = offset
+		}
+		u := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if _, offset_ := u.Zone(); offset_ == offset && (!found || u.Before(first)) {
+			first, found = u, true
+		}
+	}
+	if found {
+		return first
+	}
+	// the transitions occur on the second, which is looked for by bisection.
+	lo, hi := wall.Unix()-int64(maxOffset), wall.Unix()-int64(minOffset)
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		_, offset := time.Unix(mid, 0).In(loc).Zone()
+		if time.Unix(mid+int64(offset), 0).Before(wall) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return time.Unix(hi, 0).In(loc)
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// Returns the path for the cycle that t belongs to.
+func (r *TimeBasedRotation) Path(t time.Time) string {
+	return Strftime(r.Pattern, r.CycleStart(t))
+}
+
+// IDBuilder returns the time the current cycle begins at in seconds since the epoch.  The method
+// value can be passed to NewDynamicRotatingWriter as it is.
+func (r *TimeBasedRotation) IDBuilder(_ io.Writer, _ interface{}) string {
+	return strconv.FormatInt(r.CycleStart(r.now()).Unix(), 10)
+}
+
+// HeadPathGenerator returns the path for the cycle identified by the ID which has been built by
+// IDBuilder.  The method value can be passed to NewDynamicRotatingWriter as it is.
+func (r *TimeBasedRotation) HeadPathGenerator(ID string, _ interface{}) string {
+	secs, err := strconv.ParseInt(ID, 10, 64)
+	if err != nil {
+		return r.Path(r.now())
+	}
+	return r.Path(time.Unix(secs, 0))
+}
+
+// PathBuilder returns the path for the current cycle.  The method value can be passed to
+// NewStaticRotatingWriter as it is.
+func (r *TimeBasedRotation) PathBuilder(_ interface{}) (string, error) {
+	return r.Path(r.now()), nil
+}
+
+// Formats t according to the strftime(3)-style pattern.  See TimeBasedRotation for the supported
+// conversion specifications.  Unknown ones are left as they are.
+func Strftime(pattern string, t time.Time) string {
+	buf := bytes.Buffer{}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i+1 >= len(pattern) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&buf, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&buf, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&buf, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&buf, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&buf, "%2d", t.Day())
+		case 'j':
+			fmt.Fprintf(&buf, "%03d", t.YearDay())
+		case 'H':
+			fmt.Fprintf(&buf, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&buf, "%02d", (t.Hour()+11)%12+1)
+		case 'M':
+			fmt.Fprintf(&buf, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&buf, "%02d", t.Second())
+		case 'p':
+			buf.WriteString(t.Format("PM"))
+		case 'a':
+			buf.WriteString(t.Format("Mon"))
+		case 'A':
+			buf.WriteString(t.Format("Monday"))
+		case 'b':
+			buf.WriteString(t.Format("Jan"))
+		case 'B':
+			buf.WriteString(t.Format("January"))
+		case 'z':
+			buf.WriteString(t.Format("-0700"))
+		case 'Z':
+			buf.WriteString(t.Format("MST"))
+		case 's':
+			buf.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'F':
+			buf.WriteString(t.Format("2006-01-02"))
+		case 'T':
+			buf.WriteString(t.Format("15:04:05"))
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(pattern[i])
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStrftime(t *testing.T) {
+	tm := time.Date(2026, 10, 6, 15, 4, 5, 0, time.UTC)
+	s := Strftime("%Y%m%d-%H%M%S %y %j %I%p %e %a %b %F %T %Z %% %q", tm)
+	expected := "20261006-150405 26 279 03PM  6 Tue Oct 2026-10-06 15:04:05 UTC % %q"
+	if s != expected {
+		t.Logf("%s", s)
+		t.Fail()
+	}
+}
+
+func TestTimeBasedRotationUTC(t *testing.T) {
+	r := NewTimeBasedRotation("app-%Y%m%d-%H%M.log", 15*time.Minute, time.UTC)
+	if p := r.Path(time.Date(2026, 10, 16, 12, 44, 59, 0, time.UTC)); p != "app-20261016-1230.log" {
+		t.Logf("%s", p)
+		t.Fail()
+	}
+	r.Interval = 48 * time.Hour
+	a := r.Path(time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC))
+	b := r.Path(time.Date(2026, 10, 17, 1, 0, 0, 0, time.UTC))
+	c := r.Path(time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC))
+	if a != b || b == c {
+		t.Logf("%s %s %s", a, b, c)
+		t.Fail()
+	}
+}
+
+func TestTimeBasedRotationDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no timezone database available")
+	}
+	r := NewTimeBasedRotation("%Y%m%d-%H", time.Hour, loc)
+	// 2026-11-01 01:00-02:00 occurs twice in New York.
+	base := time.Date(2026, 11, 1, 4, 30, 0, 0, time.UTC) // 00:30 EDT
+	paths := []string{}
+	for i := 0; i < 4; i++ {
+		paths = append(paths, r.Path(base.Add(time.Duration(i)*time.Hour)))
+	}
+	expected := []string{"20261101-00", "20261101-01", "20261101-01", "20261101-02"}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Logf("%v", paths)
+			t.Fail()
+			break
+		}
+	}
+	r.Interval = 24 * time.Hour
+	// 2026-03-08 is only 23 hours long in New York.
+	if p := r.Path(time.Date(2026, 3, 9, 3, 30, 0, 0, time.UTC)); p != "20260308-00" {
+		t.Logf("%s", p)
+		t.Fail()
+	}
+	r.Pattern = "%Y%m%d-%H%M"
+	for _, c := range []struct {
+		interval time.Duration
+		base     time.Time
+		expected []string
+	}{
+		// 01:00-02:00 occurs twice; the cycle that has begun at 01:30 EDT lasts until 02:00 EST.
+		{30 * time.Minute, time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC), []string{"20261101-0000", "20261101-0000", "20261101-0000", "20261101-0030", "20261101-0030", "20261101-0030", "20261101-0100", "20261101-0100", "20261101-0100", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0130", "20261101-0200"}},
+		{2 * time.Hour, time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC), []string{"20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0000", "20261101-0200"}},
+		// 02:00-03:00 doesn't exist; the cycles that would begin in between begin at 03:00 EDT.
+		{30 * time.Minute, time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC), []string{"20260308-0100", "20260308-0100", "20260308-0100", "20260308-0130", "20260308-0130", "20260308-0130", "20260308-0300", "20260308-0300", "20260308-0300", "20260308-0330", "20260308-0330", "20260308-0330", "20260308-0400"}},
+		{2 * time.Hour, time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC), []string{"20260308-0000", "20260308-0000", "20260308-0000", "20260308-0000", "20260308-0000", "20260308-0000", "20260308-0300", "20260308-0300", "20260308-0300", "20260308-0300", "20260308-0300", "20260308-0300", "20260308-0400"}},
+	} {
+		r.Interval = c.interval
+		now := c.base
+		r.Clock = func() time.Time { return now }
+		paths := []string{}
+		lastID := int64(0)
+		for i := range c.expected {
+			now = c.base.Add(time.Duration(i) * 10 * time.Minute)
+			ID := r.IDBuilder(nil, nil)
+			secs, _ := strconv.ParseInt(ID, 10, 64)
+			// the cycles never go backwards, and the ID maps back to the path of the cycle.
+			if secs < lastID || secs > now.Unix() || r.HeadPathGenerator(ID, nil) != r.Path(now) {
+				t.Logf("%s: %s %s %s", now, ID, r.HeadPathGenerator(ID, nil), r.Path(now))
+				t.Fail()
+			}
+			lastID = secs
+			paths = append(paths, r.Path(now))
+		}
+		if !reflect.DeepEqual(paths, c.expected) {
+			t.Logf("%s %v", c.interval, paths)
+			t.Fail()
+		}
+	}
+}
+
+func TestTimeBasedRotationDynamicRotatingWriter(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	now := time.Date(2026, 10, 16, 11, 59, 0, 0, time.UTC)
+	r := NewTimeBasedRotation(filepath.Join(baseDir, "%Y%m%d-%H.log"), time.Hour, time.UTC)
+	r.Clock = func() time.Time { return now }
+	w := NewDynamicRotatingWriter(r.IDBuilder, StandardWriterFactory, r.HeadPathGenerator, nil, nil)
+	w.Write([]byte("aaa\n"))
+	now = now.Add(time.Minute)
+	w.Write([]byte("bbb\n"))
+	w.Write([]byte("ccc\n"))
+	w.Close()
+	b, err := ioutil.ReadFile(filepath.Join(baseDir, "20261016-11.log"))
+	if err != nil || string(b) != "aaa\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+	b, err = ioutil.ReadFile(filepath.Join(baseDir, "20261016-12.log"))
+	if err != nil || string(b) != "bbb\nccc\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
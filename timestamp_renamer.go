@@ -0,0 +1,127 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layout TimestampRotationCallbackFactory uses.
+const DefaultTimestampLayout = "20060102T150405"
+
+func pathExists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns the first of path, path-1, path-2, ... that is not taken by any file, including the ones
+// compressed by Compressor.
+func findVacantPath(path string) (string, error) {
+	candidate := path
+	for i := 1; ; i++ {
+		taken := false
+		for _, suffix := range rotatedFileSuffixes {
+			exists, err := pathExists(candidate + suffix)
+			if err != nil {
+				return "", err
+			}
+			if exists {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = path + "-" + strconv.Itoa(i)
+	}
+}
+
+func suffixingRenamer(suffix func(ID string) string) Renamer {
+	return func(ID, path, src string, _ interface{}) (string, error) {
+		newPath, err := findVacantPath(path + "." + suffix(ID))
+		if err != nil {
+			return "", err
+		}
+		return newPath, os.Rename(src, newPath)
+	}
+}
+
+// This is a factory function that returns a Renamer which moves the file to the one suffixed by
+// the time of the rotation formatted with layout, like "app.log.20261016T120000".  Unlike
+// SerialRenamer, only a single rename happens on each rotation.  If the destination is already
+// taken, "-1", "-2" and so forth is appended to it in that order.  clock can be nil.
+func TimestampRenamer(layout string, clock Clock) Renamer {
+	if clock == nil {
+		clock = time.Now
+	}
+	return suffixingRenamer(func(_ string) string {
+		return clock().Format(layout)
+	})
+}
+
+// This is a factory function that returns a Renamer which moves the file to the one suffixed by
+// the ID of the rotation cycle the file belongs to.  Collisions are resolved in the same way as
+// TimestampRenamer.
+func IDSuffixRenamer() Renamer {
+	return suffixingRenamer(func(ID string) string {
+		return ID
+	})
+}
+
+// This is a factory function that returns a RotationCallback which does the same as the Renamer
+// returned by TimestampRenamer with DefaultTimestampLayout.
+func TimestampRotationCallbackFactory() RotationCallback {
+	return TimestampRenamer(DefaultTimestampLayout, nil).RotationCallback()
+}
+
+// This is a factory function that returns a SiblingMatcher that only accepts the files named by
+// TimestampRenamer with the same layout.
+func TimestampSiblingMatcher(layout string) SiblingMatcher {
+	return func(headPath, path string) bool {
+		if !strings.HasPrefix(path, headPath+".") {
+			return false
+		}
+		rest := trimRotatedFileSuffix(path[len(headPath)+1:])
+		_, err := time.Parse(layout, rest)
+		if err != nil {
+			i := strings.LastIndex(rest, "-")
+			if i < 0 {
+				return false
+			}
+			_, err = strconv.ParseUint(rest[i+1:], 10, 64)
+			if err != nil {
+				return false
+			}
+			_, err = time.Parse(layout, rest[:i])
+		}
+		return err == nil
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimestampRenamer(t *testing.T) {
+	count := 0
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	headPath := filepath.Join(baseDir, "TEST")
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	p := &RetentionPolicy{
+		MaxCount: 3,
+		Matcher:  TimestampSiblingMatcher(DefaultTimestampLayout),
+	}
+	w := NewDynamicRotatingWriter(
+		func(_ io.Writer, _ interface{}) string {
+			count += 1
+			return strconv.Itoa(count)
+		},
+		StandardWriterFactory,
+		func(_ string, _ interface{}) string {
+			return headPath
+		},
+		p.RotationCallback(TimestampRenamer(DefaultTimestampLayout, func() time.Time { return now }).RotationCallback()),
+		nil,
+	)
+	w.Write([]byte("aaa\n"))
+	w.Write([]byte("bbb\n"))
+	now = now.Add(time.Second)
+	w.Write([]byte("ccc\n"))
+	w.Write([]byte("ddd\n"))
+	w.Write([]byte("eee\n"))
+	w.Close()
+	expected := map[string]string{
+		headPath:                        "eee\n",
+		headPath + ".20261016T120001":   "bbb\n",
+		headPath + ".20261016T120001-1": "ccc\n",
+		headPath + ".20261016T120001-2": "ddd\n",
+	}
+	for path, content := range expected {
+		b, err := ioutil.ReadFile(path)
+		if err != nil || string(b) != content {
+			t.Logf("%s: %q %v", path, b, err)
+			t.Fail()
+		}
+	}
+	names, _ := filepath.Glob(headPath + "*")
+	if len(names) != 4 {
+		t.Logf("%v", names)
+		t.Fail()
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OpenMode specifies what FileWriterFactory does with the file that already exists.
+type OpenMode int
+
+const (
+	// Appends the data to the existing file.
+	OpenAppend OpenMode = iota
+	// Truncates the existing file.
+	OpenTruncate
+	// Fails if the file exists.
+	OpenExclusive
+)
+
+// FileWriterFactory builds a WriterFactory that opens files with the configured options.  Its
+// WriterFactory method value can be passed wherever a WriterFactory is taken.
+//
+// If MkdirAll is true, the missing parent directories are created with DirMode.  If Chown is true,
+// the created directories and the opened files are owned by UID and GID, either of which can be -1
+// to leave it unchanged.  If Lock is true, an exclusive advisory lock (flock(2)) is acquired on the
+// file without blocking, so that opening a file that another process is writing fails.  The lock is
+// released when the file is closed.  If DSync is true, the file is opened with O_DSYNC, which
+// should be preferred to DurabilityDSync when Lock is true, as the latter would otherwise have to
+// reopen the file.
+type FileWriterFactory struct {
+	MkdirAll bool
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	OpenMode OpenMode
+	Chown    bool
+	UID      int
+	GID      int
+	Lock     bool
+	DSync    bool
+}
+
+// Creates a new FileWriterFactory that behaves the same as StandardWriterFactory except that it
+// creates the missing parent directories.
+func NewFileWriterFactory() *FileWriterFactory {
+	return &FileWriterFactory{
+		MkdirAll: true,
+		DirMode:  os.FileMode(0777),
+		FileMode: os.FileMode(0666),
+		OpenMode: OpenAppend,
+		Chown:    false,
+		UID:      -1,
+		GID:      -1,
+		Lock:     false,
+		DSync:    false,
+	}
+}
+
+// lockedFile is an *os.File on which an advisory lock has been acquired.
+type lockedFile struct {
+	*os.File
+	dsync bool
+}
+
+// WriterFactory opens the file according to the options.  The method value can be passed to
+// NewDynamicRotatingWriter and NewStaticRotatingWriter as it is.
+func (f *FileWriterFactory) WriterFactory(path string, _ interface{}) (io.Writer, error) {
+	if f.MkdirAll {
+		err := f.mkdirAll(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+	}
+	flags := os.O_CREATE | os.O_WRONLY
+	switch f.OpenMode {
+	case OpenAppend:
+		flags |= os.O_APPEND
+	case OpenTruncate:
+		flags |= os.O_TRUNC
+	case OpenExclusive:
+		flags |= os.O_EXCL
+	}
+	if f.DSync {
+		flags |= oDSync
+	}
+	fileMode := f.FileMode
+	if fileMode == 0 {
+		fileMode = os.FileMode(0666)
+	}
+	file, err := os.OpenFile(path, flags, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	if f.Chown {
+		err = file.Chown(f.UID, f.GID)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if !f.Lock {
+		return file, nil
+	}
+	err = lockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, &os.PathError{Op: "flock", Path: path, Err: err}
+	}
+	return &lockedFile{File: file, dsync: f.DSync}, nil
+}
+
+// Creates the directory and its missing parents one by one, so that each of them can be chown'ed.
+func (f *FileWriterFactory) mkdirAll(dir string) error {
+	fi, err := os.Stat(dir)
+	if err == nil {
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: os.ErrExist}
+		}
+		return nil
+	}
+	parent := filepath.Dir(dir)
+	if parent != dir {
+		err = f.mkdirAll(parent)
+		if err != nil {
+			return err
+		}
+	}
+	dirMode := f.DirMode
+	if dirMode == 0 {
+		dirMode = os.FileMode(0777)
+	}
+	err = os.Mkdir(dir, dirMode)
+	if err != nil {
+		if os.IsExist(err) {
+			// someone else has just created it.
+			return nil
+		}
+		return err
+	}
+	if f.Chown {
+		return os.Chown(dir, f.UID, f.GID)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2014-2015 Moriyoshi Koizumi
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ioextras
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFileWriterFactory(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	f := NewFileWriterFactory()
+	f.DirMode = os.FileMode(0750)
+	w := NewStaticRotatingWriter(
+		func(ctx interface{}) (string, error) {
+			return filepath.Join(baseDir, "logs", ctx.(string), "app.log"), nil
+		},
+		f.WriterFactory,
+		nil,
+	)
+	w.WriteWithCtx([]byte("aaa\n"), "2026/10/16")
+	w.WriteWithCtx([]byte("bbb\n"), "2026/10/16")
+	w.WriteWithCtx([]byte("ccc\n"), "2026/10/17")
+	w.Close()
+	b, err := ioutil.ReadFile(filepath.Join(baseDir, "logs", "2026", "10", "16", "app.log"))
+	if err != nil || string(b) != "aaa\nbbb\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+	fi, err := os.Stat(filepath.Join(baseDir, "logs", "2026", "10", "17"))
+	if err != nil || !fi.IsDir() {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&^os.FileMode(0750) != 0 {
+		t.Logf("%v", fi.Mode())
+		t.Fail()
+	}
+}
+
+func TestFileWriterFactoryOpenMode(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	path := filepath.Join(baseDir, "TEST")
+	err = ioutil.WriteFile(path, []byte("xxx\n"), os.FileMode(0666))
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	f := NewFileWriterFactory()
+	f.OpenMode = OpenExclusive
+	_, err = f.WriterFactory(path, nil)
+	if !os.IsExist(err) {
+		t.Logf("%v", err)
+		t.Fail()
+	}
+	f.OpenMode = OpenTruncate
+	wr, err := f.WriterFactory(path, nil)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	wr.Write([]byte("aaa\n"))
+	wr.(io.Closer).Close()
+	b, err := ioutil.ReadFile(path)
+	if err != nil || string(b) != "aaa\n" {
+		t.Logf("%q %v", b, err)
+		t.Fail()
+	}
+}
+
+func TestFileWriterFactoryLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("advisory locks are not supported")
+	}
+	baseDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(baseDir)
+	path := filepath.Join(baseDir, "TEST")
+	f := NewFileWriterFactory()
+	f.Lock = true
+	wr, err := f.WriterFactory(path, nil)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	_, err = f.WriterFactory(path, nil)
+	if err == nil {
+		t.Logf("the file has been opened twice")
+		t.Fail()
+	}
+	// the lock must survive DurabilityDSync.
+	wr, err = DurabilityPolicy{Mode: DurabilityDSync}.wrap(wr)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	_, err = f.WriterFactory(path, nil)
+	if err == nil {
+		t.Logf("the lock has been lost")
+		t.Fail()
+	}
+	wr.(io.Closer).Close()
+	wr, err = f.WriterFactory(path, nil)
+	if err != nil {
+		t.Logf("%v", err)
+		t.FailNow()
+	}
+	wr.(io.Closer).Close()
+}